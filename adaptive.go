@@ -0,0 +1,153 @@
+package throttler
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// adaptiveRate is implemented by the rates which adapt to the responses of the
+// provider, so the throttler reports them the result of every sent request
+type adaptiveRate interface {
+	observe(sent time.Time, res *Response)
+}
+
+// AdaptiveRate is a Rate which adapts to the capacity of the provider with the
+// additive increase, multiplicative decrease algorithm: it raises the calls per
+// second additively while the responses are healthy and cuts them
+// multiplicatively when the provider is overloaded, within a minimal and a
+// maximal Rate. Used as the rate of a throttler, it is fed with the responses of
+// the requests sent by it, also when it is the rate of a rule of NewScheduledRate.
+type AdaptiveRate struct {
+	mu           sync.Mutex
+	min          float64
+	max          float64
+	increase     float64
+	decrease     float64
+	maxLatency   time.Duration
+	current      float64
+	changed      time.Time
+	lastDecrease time.Time
+	now          func() time.Time
+}
+
+// NewAdaptiveRate initializes an AdaptiveRate starting at min, the slowest rate,
+// which never exceeds max, the fastest one. Every second of healthy responses the
+// rate is raised by increase calls per second. A response is unhealthy when the
+// client returns an error, like a timeout, when its status is 429, 503 or 504, or
+// when it takes longer than maxLatency, if it is not zero. Then the calls per
+// second are multiplied by decrease, between 0 and 1.
+func NewAdaptiveRate(min Rate, max Rate, increase float64, decrease float64, maxLatency time.Duration) (*AdaptiveRate, error) {
+	if min == nil || max == nil {
+		return nil, fmt.Errorf("min and max can not be nil")
+	}
+	if min.CalculateRate() <= 0 || max.CalculateRate() <= 0 {
+		return nil, fmt.Errorf("min and max must be greater than zero")
+	}
+	if min.CalculateRate() < max.CalculateRate() {
+		return nil, fmt.Errorf("min can not be faster than max")
+	}
+	if increase <= 0 {
+		return nil, fmt.Errorf("increase must be greater than zero")
+	}
+	if decrease <= 0 || decrease >= 1 {
+		return nil, fmt.Errorf("decrease must be greater than 0 and less than 1")
+	}
+	if maxLatency < 0 {
+		return nil, fmt.Errorf("maxLatency must be greater or equal than zero")
+	}
+	a := &AdaptiveRate{
+		min:        callsPerSecond(min.CalculateRate()),
+		max:        callsPerSecond(max.CalculateRate()),
+		increase:   increase,
+		decrease:   decrease,
+		maxLatency: maxLatency,
+		now:        time.Now,
+	}
+	a.current = a.min
+	a.changed = a.now()
+	a.lastDecrease = a.changed
+	return a, nil
+}
+
+func callsPerSecond(period time.Duration) float64 {
+	return float64(time.Second) / float64(period)
+}
+
+// CalculateRate returns the period of the current calls per second.
+func (a *AdaptiveRate) CalculateRate() time.Duration {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return time.Duration(float64(time.Second) / a.current)
+}
+
+// CallsPerSecond returns the current calls per second.
+func (a *AdaptiveRate) CallsPerSecond() float64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.current
+}
+
+// observe adapts the rate to the response of a request sent at the given time.
+// The requests sent before the last decrease do not decrease the rate again, as
+// they were sent at the previous rate.
+func (a *AdaptiveRate) observe(sent time.Time, res *Response) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := a.now()
+	if a.healthy(now.Sub(sent), res) {
+		if now.Sub(a.changed) < time.Second {
+			return
+		}
+		a.current += a.increase
+		if a.current > a.max {
+			a.current = a.max
+		}
+		a.changed = now
+		return
+	}
+	if sent.Before(a.lastDecrease) {
+		return
+	}
+	a.current *= a.decrease
+	if a.current < a.min {
+		a.current = a.min
+	}
+	a.changed = now
+	a.lastDecrease = now
+}
+
+// healthy reports whether the response shows that the provider is not overloaded
+func (a *AdaptiveRate) healthy(latency time.Duration, res *Response) bool {
+	if res.Err != nil {
+		return false
+	}
+	if a.maxLatency > 0 && latency > a.maxLatency {
+		return false
+	}
+	switch res.HRes.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return false
+	}
+	return true
+}
+
+// adaptiveSender reports the result of every sent request to the rate of the
+// throttler, if it is adaptive
+type adaptiveSender struct {
+	next sender
+	t    *throttler
+}
+
+func (s *adaptiveSender) send(req *Request) *Response {
+	sent := time.Now()
+	res := s.next.send(req)
+	s.t.mu.Lock()
+	r := s.t.rate
+	s.t.mu.Unlock()
+	if a, ok := r.(adaptiveRate); ok {
+		a.observe(sent, res)
+	}
+	return res
+}
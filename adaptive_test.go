@@ -0,0 +1,130 @@
+package throttler_test
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/centraldereservas/throttler"
+)
+
+func TestNewAdaptiveRate(t *testing.T) {
+	slow, _ := throttler.NewRateByCallsPerSecond(1, 0)
+	fast, _ := throttler.NewRateByCallsPerSecond(10, 0)
+
+	tt := []struct {
+		name       string
+		min        throttler.Rate
+		max        throttler.Rate
+		increase   float64
+		decrease   float64
+		maxLatency time.Duration
+		errMsg     string
+	}{
+		{"Positive TC", slow, fast, 1, 0.5, time.Second, ""},
+		{"Positive TC: min equal to max", slow, slow, 1, 0.5, 0, ""},
+		{"Negative TC: min nil", nil, fast, 1, 0.5, 0, "min and max can not be nil"},
+		{"Negative TC: min faster than max", fast, slow, 1, 0.5, 0, "min can not be faster than max"},
+		{"Negative TC: increase zero", slow, fast, 0, 0.5, 0, "increase must be greater than zero"},
+		{"Negative TC: decrease one", slow, fast, 1, 1, 0, "decrease must be greater than 0 and less than 1"},
+		{"Negative TC: decrease zero", slow, fast, 1, 0, 0, "decrease must be greater than 0 and less than 1"},
+		{"Negative TC: negative maxLatency", slow, fast, 1, 0.5, -time.Second, "maxLatency must be greater or equal than zero"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := throttler.NewAdaptiveRate(tc.min, tc.max, tc.increase, tc.decrease, tc.maxLatency)
+			checkError(tc.errMsg, err, t)
+		})
+	}
+}
+
+func TestAdaptiveRate(t *testing.T) {
+	slow, _ := throttler.NewRateByCallsPerSecond(2, 0)
+	fast, _ := throttler.NewRateByCallsPerSecond(10, 0)
+	a, _ := throttler.NewAdaptiveRate(slow, fast, 2, 0.5, 500*time.Millisecond)
+	now := time.Now()
+	throttler.SetAdaptiveClock(a, func() time.Time { return now })
+
+	tt := []struct {
+		name    string
+		advance time.Duration
+		sent    time.Duration
+		status  int
+		err     error
+		calls   float64
+	}{
+		{"Positive TC: starts at min", 0, 0, 0, nil, 2},
+		{"Positive TC: no increase before a second", 500 * time.Millisecond, 0, http.StatusOK, nil, 2},
+		{"Positive TC: additive increase", 500 * time.Millisecond, 0, http.StatusOK, nil, 4},
+		{"Positive TC: increase once per second", 100 * time.Millisecond, 0, http.StatusOK, nil, 4},
+		{"Positive TC: second increase", time.Second, 0, http.StatusOK, nil, 6},
+		{"Positive TC: third increase", time.Second, 0, http.StatusOK, nil, 8},
+		{"Positive TC: fourth increase", time.Second, 0, http.StatusOK, nil, 10},
+		{"Positive TC: bounded by max", time.Second, 0, http.StatusOK, nil, 10},
+		{"Positive TC: slow response cuts", time.Second, -600 * time.Millisecond, http.StatusOK, nil, 5},
+		{"Positive TC: 429 cuts", 0, 0, http.StatusTooManyRequests, nil, 2.5},
+		{"Positive TC: sent before the cut", time.Millisecond, -10 * time.Millisecond, http.StatusServiceUnavailable, nil, 2.5},
+		{"Positive TC: error cuts down to min", time.Millisecond, 0, 0, errors.New("timeout"), 2},
+		{"Positive TC: no increase before a second after the cut", 500 * time.Millisecond, 0, http.StatusOK, nil, 2},
+		{"Positive TC: increase after the cut", 500 * time.Millisecond, 0, http.StatusOK, nil, 4},
+		{"Positive TC: sent before the increase cuts", time.Millisecond, -10 * time.Millisecond, http.StatusTooManyRequests, nil, 2},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			now = now.Add(tc.advance)
+			if tc.status != 0 || tc.err != nil {
+				throttler.ObserveAdaptive(a, now.Add(tc.sent), tc.status, tc.err)
+			}
+			if c := a.CallsPerSecond(); c != tc.calls {
+				t.Errorf("expected %v calls per second; got %v", tc.calls, c)
+			}
+		})
+	}
+}
+
+func TestAdaptiveRateQueue(t *testing.T) {
+	slow, _ := throttler.NewRateByCallsPerSecond(10, 0)
+	fast, _ := throttler.NewRateByCallsPerSecond(100, 0)
+
+	// the throttler feeds the rate with the responses of the sent requests
+	tt := []struct {
+		name      string
+		scheduled bool
+		statuses  []int32
+		calls     float64
+	}{
+		{"Positive TC: healthy response", false, []int32{http.StatusOK}, 20},
+		{"Positive TC: overloaded provider", false, []int32{http.StatusOK, http.StatusTooManyRequests}, 10},
+		{"Positive TC: healthy response of a scheduled rate", true, []int32{http.StatusOK}, 20},
+		{"Positive TC: overloaded provider of a scheduled rate", true, []int32{http.StatusOK, http.StatusTooManyRequests}, 10},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			a, _ := throttler.NewAdaptiveRate(slow, fast, 10, 0.5, 0)
+			// the clock of the rate runs a second ahead, so the first healthy response raises it
+			throttler.SetAdaptiveClock(a, func() time.Time { return time.Now().Add(time.Second) })
+			var rate throttler.Rate = a
+			if tc.scheduled {
+				rate, _ = throttler.NewScheduledRate(a)
+			}
+			var status int32
+			limiter, _ := throttler.New(rate, 5, newBreakerClient(&status, &sync.WaitGroup{}), false)
+			limiter.Run()
+			for _, s := range tc.statuses {
+				atomic.StoreInt32(&status, s)
+				if _, err := queueStatus(limiter); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+			if c := a.CallsPerSecond(); c != tc.calls {
+				t.Errorf("expected %v calls per second; got %v", tc.calls, c)
+			}
+		})
+	}
+}
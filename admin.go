@@ -0,0 +1,204 @@
+package throttler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// adminStatus is the JSON body returned by the admin handler
+type adminStatus struct {
+	Rate          string         `json:"rate"`
+	Paused        bool           `json:"paused"`
+	PausedUntil   *time.Time     `json:"paused_until,omitempty"`
+	QueueLength   int            `json:"queue_length"`
+	QueueCapacity int            `json:"queue_capacity"`
+	InFlight      int            `json:"in_flight"`
+	Breaker       string         `json:"breaker"`
+	Requests      []adminRequest `json:"requests"`
+	Purged        *int           `json:"purged,omitempty"`
+	Cancelled     *int           `json:"cancelled,omitempty"`
+}
+
+// adminRequest describes a queued request in the admin status
+type adminRequest struct {
+	ID       uint64    `json:"id"`
+	Name     string    `json:"name"`
+	State    string    `json:"state"`
+	QueuedAt time.Time `json:"queued_at"`
+	WaitMs   float64   `json:"wait_ms"`
+}
+
+// adminHandler serves the admin API of a throttler
+type adminHandler struct {
+	t *throttler
+}
+
+// NewAdminHandler returns an http.Handler to inspect and control the throttler l,
+// which must be created with New. GET /status returns the current rate, the pause
+// state, the length and capacity of the queue, the number of requests in flight,
+// the state of the circuit breaker and the name, state and wait time of every
+// queued request. The POST actions
+// return the same status after doing:
+//
+//	POST /pause                   pauses the throttler, until the given
+//	                              time with ?until=RFC3339 or for the given
+//	                              duration with ?for=30s
+//	POST /resume                  resumes the throttler
+//	POST /rate?rate=120/min+50ms  changes the rate, parsed with ParseRate
+//	POST /purge                   fails the requests waiting in the queue with ErrPurged
+//	POST /cancel?id=42            cancels the request with the given ID, or
+//	POST /cancel?name=search      the ones with the given name, with ErrCancelled
+//
+// The handler allows full control of the throttler, so it should not be exposed
+// to untrusted clients.
+func NewAdminHandler(l Limiter) (http.Handler, error) {
+	t, ok := l.(*throttler)
+	if !ok {
+		return nil, fmt.Errorf("limiter must be created with New")
+	}
+	return &adminHandler{t: t}, nil
+}
+
+func (h *adminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/status" {
+		if r.Method != http.MethodGet {
+			writeAdminError(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed"))
+			return
+		}
+		writeAdminStatus(w, h.status(nil, nil))
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeAdminError(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed"))
+		return
+	}
+	var purged, cancelled *int
+	switch r.URL.Path {
+	case "/pause":
+		if err := h.pause(r); err != nil {
+			writeAdminError(w, http.StatusBadRequest, err)
+			return
+		}
+	case "/resume":
+		h.t.Resume()
+	case "/rate":
+		rate, err := ParseRate(r.URL.Query().Get("rate"))
+		if err != nil {
+			writeAdminError(w, http.StatusBadRequest, err)
+			return
+		}
+		if err := h.t.SetRate(rate); err != nil {
+			writeAdminError(w, http.StatusBadRequest, err)
+			return
+		}
+	case "/purge":
+		n := h.t.purge()
+		purged = &n
+	case "/cancel":
+		n, err := h.cancel(r)
+		if err != nil {
+			writeAdminError(w, http.StatusBadRequest, err)
+			return
+		}
+		cancelled = &n
+	default:
+		writeAdminError(w, http.StatusNotFound, fmt.Errorf("unknown endpoint %q", r.URL.Path))
+		return
+	}
+	writeAdminStatus(w, h.status(purged, cancelled))
+}
+
+// cancel cancels the request with the ID or the requests with the name given in the query
+func (h *adminHandler) cancel(r *http.Request) (int, error) {
+	q := r.URL.Query()
+	switch {
+	case q.Get("id") != "" && q.Get("name") != "":
+		return 0, fmt.Errorf("id and name can not be both set")
+	case q.Get("id") != "":
+		id, err := strconv.ParseUint(q.Get("id"), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid id %q", q.Get("id"))
+		}
+		if h.t.CancelByID(id) {
+			return 1, nil
+		}
+		return 0, nil
+	case q.Get("name") != "":
+		return h.t.CancelByName(q.Get("name")), nil
+	}
+	return 0, fmt.Errorf("id or name is required")
+}
+
+// pause pauses the throttler indefinitely or until the time given in the query
+func (h *adminHandler) pause(r *http.Request) error {
+	q := r.URL.Query()
+	switch {
+	case q.Get("until") != "" && q.Get("for") != "":
+		return fmt.Errorf("until and for can not be both set")
+	case q.Get("until") != "":
+		until, err := time.Parse(time.RFC3339, q.Get("until"))
+		if err != nil {
+			return fmt.Errorf("invalid until %q", q.Get("until"))
+		}
+		h.t.PauseUntil(until)
+	case q.Get("for") != "":
+		d, err := time.ParseDuration(q.Get("for"))
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid for %q", q.Get("for"))
+		}
+		h.t.PauseUntil(time.Now().Add(d))
+	default:
+		h.t.Pause()
+	}
+	return nil
+}
+
+func (h *adminHandler) status(purged *int, cancelled *int) adminStatus {
+	state := h.t.State()
+	s := adminStatus{
+		Rate:          state.Rate.String(),
+		Paused:        state.Paused,
+		QueueLength:   state.QueueLength,
+		QueueCapacity: state.QueueCapacity,
+		InFlight:      state.InFlight,
+		Breaker:       state.Breaker.String(),
+		Requests:      []adminRequest{},
+		Purged:        purged,
+		Cancelled:     cancelled,
+	}
+	if !state.PausedUntil.IsZero() {
+		s.PausedUntil = &state.PausedUntil
+	}
+	now := time.Now()
+	for _, q := range h.t.tracked() {
+		if q.cancelled {
+			continue
+		}
+		r := adminRequest{
+			ID:       q.req.ID,
+			Name:     q.req.Name,
+			State:    "waiting",
+			QueuedAt: q.queuedAt,
+			WaitMs:   float64(now.Sub(q.queuedAt)) / float64(time.Millisecond),
+		}
+		if q.inFlight {
+			r.State = "in_flight"
+		}
+		s.Requests = append(s.Requests, r)
+	}
+	return s
+}
+
+func writeAdminStatus(w http.ResponseWriter, s adminStatus) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s)
+}
+
+func writeAdminError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
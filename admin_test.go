@@ -0,0 +1,175 @@
+package throttler_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/centraldereservas/throttler"
+)
+
+type adminStatus struct {
+	Rate          string     `json:"rate"`
+	Paused        bool       `json:"paused"`
+	PausedUntil   *time.Time `json:"paused_until"`
+	QueueLength   int        `json:"queue_length"`
+	QueueCapacity int        `json:"queue_capacity"`
+	InFlight      int        `json:"in_flight"`
+	Requests      []struct {
+		Name  string `json:"name"`
+		State string `json:"state"`
+	} `json:"requests"`
+	Purged    *int `json:"purged"`
+	Cancelled *int `json:"cancelled"`
+}
+
+func serveAdmin(h http.Handler, method string, target string) (*httptest.ResponseRecorder, adminStatus) {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+	var s adminStatus
+	json.Unmarshal(w.Body.Bytes(), &s)
+	return w, s
+}
+
+func TestNewAdminHandler(t *testing.T) {
+	rate, _ := throttler.NewRateByCallsPerSecond(10, 0)
+	limiter, _ := throttler.New(rate, 5, nil, false)
+
+	tt := []struct {
+		name    string
+		limiter throttler.Limiter
+		errMsg  string
+	}{
+		{"Positive TC", limiter, ""},
+		{"Negative TC: not created with New", &MockLimiter{}, "limiter must be created with New"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := throttler.NewAdminHandler(tc.limiter)
+			checkError(tc.errMsg, err, t)
+		})
+	}
+}
+
+func TestAdminHandlerActions(t *testing.T) {
+	rate, _ := throttler.NewRateByCallsPerSecond(10, 0)
+	limiter, _ := throttler.New(rate, 5, nil, false)
+	h, _ := throttler.NewAdminHandler(limiter)
+
+	tt := []struct {
+		name        string
+		method      string
+		target      string
+		status      int
+		paused      bool
+		pausedUntil bool
+		rate        string
+		body        string
+	}{
+		{"Positive TC: status", "GET", "/status", http.StatusOK, false, false, "100ms", ""},
+		{"Positive TC: breaker state", "GET", "/status", http.StatusOK, false, false, "100ms", `"breaker":"closed"`},
+		{"Positive TC: pause", "POST", "/pause", http.StatusOK, true, false, "100ms", ""},
+		{"Positive TC: resume", "POST", "/resume", http.StatusOK, false, false, "100ms", ""},
+		{"Positive TC: pause for", "POST", "/pause?for=1m", http.StatusOK, true, true, "100ms", ""},
+		{"Positive TC: pause until", "POST", "/pause?until=2099-01-01T00:00:00Z", http.StatusOK, true, true, "100ms", ""},
+		{"Positive TC: rate", "POST", "/rate?rate=2/s", http.StatusOK, true, true, "500ms", ""},
+		{"Negative TC: invalid rate", "POST", "/rate?rate=fast", http.StatusBadRequest, false, false, "", "invalid rate"},
+		{"Negative TC: invalid for", "POST", "/pause?for=soon", http.StatusBadRequest, false, false, "", `{"error":"invalid for \"soon\""}`},
+		{"Negative TC: until and for", "POST", "/pause?for=1m&until=2099-01-01T00:00:00Z", http.StatusBadRequest, false, false, "", `{"error":"until and for can not be both set"}`},
+		{"Negative TC: cancel without id or name", "POST", "/cancel", http.StatusBadRequest, false, false, "", `{"error":"id or name is required"}`},
+		{"Negative TC: invalid id", "POST", "/cancel?id=first", http.StatusBadRequest, false, false, "", `{"error":"invalid id \"first\""}`},
+		{"Negative TC: method", "GET", "/pause", http.StatusMethodNotAllowed, false, false, "", `{"error":"method not allowed"}`},
+		{"Negative TC: unknown endpoint", "POST", "/stop", http.StatusNotFound, false, false, "", `{"error":"unknown endpoint \"/stop\""}`},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			w, s := serveAdmin(h, tc.method, tc.target)
+			if w.Code != tc.status {
+				t.Errorf("expected status %d; got %d", tc.status, w.Code)
+			}
+			if tc.body != "" {
+				if !strings.Contains(w.Body.String(), tc.body) {
+					t.Errorf("expected body containing %s; got %s", tc.body, w.Body.String())
+				}
+				return
+			}
+			if s.Paused != tc.paused || (s.PausedUntil != nil) != tc.pausedUntil || s.Rate != tc.rate {
+				t.Errorf("unexpected status %+v", s)
+			}
+		})
+	}
+}
+
+func TestAdminHandlerRequests(t *testing.T) {
+	release := make(chan struct{})
+	client := &http.Client{
+		Transport: &MockTransport{
+			RoundTripMock: func(req *http.Request) (*http.Response, error) {
+				<-release
+				return newMockClient(http.StatusOK).Transport.RoundTrip(req)
+			},
+		},
+	}
+	rate, _ := throttler.NewRateByCallsPerSecond(100, 0)
+	limiter, _ := throttler.New(rate, 5, client, false)
+	h, _ := throttler.NewAdminHandler(limiter)
+	limiter.Run()
+	limiter.Pause()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 3)
+	for _, name := range []string{"first", "second", "third"} {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			req, _ := http.NewRequest("GET", "http://example.com/", nil)
+			res, err := limiter.Queue(context.Background(), name, req, duration10s)
+			if err == nil {
+				res.Body.Close()
+			}
+			errs <- err
+		}(name)
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	// the listener holds the first request and the others wait in the channel
+	_, s := serveAdmin(h, "GET", "/status")
+	if len(s.Requests) != 3 || s.Requests[0].Name != "first" || s.Requests[2].State != "waiting" || s.QueueLength != 2 {
+		t.Errorf("expected 3 waiting requests, 2 of them in the channel; got %+v", s)
+	}
+
+	_, s = serveAdmin(h, "POST", "/cancel?name=second")
+	if s.Cancelled == nil || *s.Cancelled != 1 || len(s.Requests) != 2 {
+		t.Errorf("expected 1 cancelled request; got %+v", s)
+	}
+	if err := <-errs; err != throttler.ErrCancelled {
+		t.Errorf("expected error %v; got %v", throttler.ErrCancelled, err)
+	}
+
+	_, s = serveAdmin(h, "POST", "/purge")
+	if s.Purged == nil || *s.Purged != 1 {
+		t.Errorf("expected 1 purged request; got %+v", s)
+	}
+	if err := <-errs; err != throttler.ErrPurged {
+		t.Errorf("expected error %v; got %v", throttler.ErrPurged, err)
+	}
+
+	serveAdmin(h, "POST", "/resume")
+	time.Sleep(50 * time.Millisecond)
+	_, s = serveAdmin(h, "GET", "/status")
+	if s.InFlight != 1 || len(s.Requests) != 1 || s.Requests[0].Name != "first" || s.Requests[0].State != "in_flight" {
+		t.Errorf("expected the first request in flight; got %+v", s)
+	}
+	close(release)
+	wg.Wait()
+	if err := <-errs; err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
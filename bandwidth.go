@@ -0,0 +1,141 @@
+package throttler
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Bandwidth paces the bytes read or written through its readers and writers to
+// a budget of bytes per second, shared by all of them. It uses the generic cell
+// rate algorithm of the GCRA strategy with one cell per byte, so up to burst
+// bytes can be transferred at once.
+type Bandwidth struct {
+	mu    sync.Mutex
+	lim   limit
+	burst int64
+	tat   time.Time
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+// NewBandwidth initializes a Bandwidth of bytesPerSecond with bursts of up to
+// burst bytes, which is also the biggest chunk read or written at once.
+func NewBandwidth(bytesPerSecond int, burst int) (*Bandwidth, error) {
+	if bytesPerSecond <= 0 {
+		return nil, fmt.Errorf("bytesPerSecond must be greater than zero")
+	}
+	if burst <= 0 {
+		return nil, fmt.Errorf("burst must be greater than zero")
+	}
+	return &Bandwidth{
+		lim:   limit{timeReference: time.Second, calls: int64(bytesPerSecond)},
+		burst: int64(burst),
+		now:   time.Now,
+		sleep: time.Sleep,
+	}, nil
+}
+
+// Reader returns a reader which paces the bytes read from r.
+func (b *Bandwidth) Reader(r io.Reader) io.Reader {
+	return &bandwidthReader{r: r, b: b}
+}
+
+// Writer returns a writer which paces the bytes written to w.
+func (b *Bandwidth) Writer(w io.Writer) io.Writer {
+	return &bandwidthWriter{w: w, b: b}
+}
+
+// wait books n bytes and blocks until they conform
+func (b *Bandwidth) wait(n int) {
+	b.mu.Lock()
+	now := b.now()
+	at := gcraNext(b.tat, now, b.lim, b.burst, int64(n))
+	b.tat = gcraCommit(b.tat, at, b.lim, int64(n))
+	b.mu.Unlock()
+	if d := at.Sub(now); d > 0 {
+		b.sleep(d)
+	}
+}
+
+type bandwidthReader struct {
+	r io.Reader
+	b *Bandwidth
+}
+
+// Read reads up to burst bytes and waits until they conform before returning them
+func (r *bandwidthReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > r.b.burst {
+		p = p[:r.b.burst]
+	}
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.b.wait(n)
+	}
+	return n, err
+}
+
+type bandwidthWriter struct {
+	w io.Writer
+	b *Bandwidth
+}
+
+// Write writes p in chunks of up to burst bytes, waiting until every chunk conforms
+func (w *bandwidthWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := p
+		if int64(len(chunk)) > w.b.burst {
+			chunk = chunk[:w.b.burst]
+		}
+		w.b.wait(len(chunk))
+		n, err := w.w.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// bandwidthBody paces a request or response body and closes the original one
+type bandwidthBody struct {
+	io.Reader
+	io.Closer
+}
+
+// bandwidthTransport paces the request and response bodies
+type bandwidthTransport struct {
+	next     http.RoundTripper
+	upload   *Bandwidth
+	download *Bandwidth
+}
+
+// NewBandwidthTransport returns an http.RoundTripper which paces the request
+// bodies with upload and the response bodies with download, any of which may
+// be nil. If next is nil http.DefaultTransport is used.
+func NewBandwidthTransport(next http.RoundTripper, upload *Bandwidth, download *Bandwidth) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &bandwidthTransport{next: next, upload: upload, download: download}
+}
+
+func (t *bandwidthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.upload != nil && req.Body != nil && req.Body != http.NoBody {
+		r := *req
+		r.Body = bandwidthBody{t.upload.Reader(req.Body), req.Body}
+		req = &r
+	}
+	res, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if t.download != nil && res.Body != nil {
+		res.Body = bandwidthBody{t.download.Reader(res.Body), res.Body}
+	}
+	return res, nil
+}
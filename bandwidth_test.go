@@ -0,0 +1,112 @@
+package throttler_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/centraldereservas/throttler"
+)
+
+func TestNewBandwidth(t *testing.T) {
+	tt := []struct {
+		name           string
+		bytesPerSecond int
+		burst          int
+		errMsg         string
+	}{
+		{"Positive TC", 100000, 10000, ""},
+		{"Negative TC: bytesPerSecond zero", 0, 10000, "bytesPerSecond must be greater than zero"},
+		{"Negative TC: burst zero", 100000, 0, "burst must be greater than zero"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := throttler.NewBandwidth(tc.bytesPerSecond, tc.burst)
+			checkError(tc.errMsg, err, t)
+		})
+	}
+}
+
+// checkPace checks that transferring 30000 bytes at 100000 bytes per second
+// with bursts of 10000 bytes took about 200ms
+func checkPace(d time.Duration, t *testing.T) {
+	if d < 190*time.Millisecond || d > 400*time.Millisecond {
+		t.Errorf("expected the transfer to take about 200ms; took %v", d)
+	}
+}
+
+func TestBandwidthReader(t *testing.T) {
+	b, _ := throttler.NewBandwidth(100000, 10000)
+	data := bytes.Repeat([]byte("x"), 30000)
+	start := time.Now()
+	got, err := ioutil.ReadAll(b.Reader(bytes.NewReader(data)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	checkPace(time.Since(start), t)
+	if !bytes.Equal(got, data) {
+		t.Errorf("expected %d bytes; got %d", len(data), len(got))
+	}
+}
+
+func TestBandwidthWriter(t *testing.T) {
+	b, _ := throttler.NewBandwidth(100000, 10000)
+	data := bytes.Repeat([]byte("x"), 30000)
+	var buf bytes.Buffer
+	start := time.Now()
+	n, err := b.Writer(&buf).Write(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	checkPace(time.Since(start), t)
+	if n != len(data) || !bytes.Equal(buf.Bytes(), data) {
+		t.Errorf("expected %d bytes; got %d", len(data), n)
+	}
+}
+
+func TestQueueWithBandwidth(t *testing.T) {
+	rate, _ := throttler.NewRateByCallsPerSecond(10, 0)
+	_, err := throttler.New(rate, 5, nil, false, throttler.WithBandwidth(nil, nil))
+	checkError("upload and download can not be both nil", err, t)
+
+	var uploaded time.Duration
+	client := &http.Client{
+		Transport: &MockTransport{
+			RoundTripMock: func(req *http.Request) (*http.Response, error) {
+				start := time.Now()
+				body, _ := ioutil.ReadAll(req.Body)
+				uploaded = time.Since(start)
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Body:       ioutil.NopCloser(bytes.NewReader(body)),
+					Header:     make(http.Header),
+					Request:    req,
+				}, nil
+			},
+		},
+	}
+	upload, _ := throttler.NewBandwidth(100000, 10000)
+	download, _ := throttler.NewBandwidth(100000, 10000)
+	limiter, _ := throttler.New(rate, 5, client, false, throttler.WithBandwidth(upload, download))
+	limiter.Run()
+
+	data := bytes.Repeat([]byte("x"), 30000)
+	req, _ := http.NewRequest("POST", "http://example.com/files", bytes.NewReader(data))
+	res, err := limiter.Queue(context.Background(), "upload", req, duration10s)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer res.Body.Close()
+	checkPace(uploaded, t)
+
+	start := time.Now()
+	got, _ := ioutil.ReadAll(res.Body)
+	checkPace(time.Since(start), t)
+	if !bytes.Equal(got, data) {
+		t.Errorf("expected %d bytes; got %d", len(data), len(got))
+	}
+}
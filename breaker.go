@@ -0,0 +1,211 @@
+package throttler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrBreakerOpen is returned by Queue when the request is rejected because the
+// circuit breaker is open.
+var ErrBreakerOpen = errors.New("circuit breaker is open")
+
+// BreakerState is the state of a circuit Breaker.
+type BreakerState int
+
+const (
+	// BreakerClosed lets the requests through while counting their failures
+	BreakerClosed BreakerState = iota
+	// BreakerOpen fails the requests with ErrBreakerOpen until the cooldown elapses
+	BreakerOpen
+	// BreakerHalfOpen lets one probe request through, which closes the breaker if
+	// it succeeds and opens it again if it fails
+	BreakerHalfOpen
+)
+
+// String returns the name of the state.
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half_open"
+	}
+	return fmt.Sprintf("BreakerState(%d)", int(s))
+}
+
+// Breaker is a circuit breaker which stops sending requests to a provider that
+// is failing. A request fails when the client returns an error or a response
+// with a 5xx status code.
+type Breaker struct {
+	mu          sync.Mutex
+	threshold   float64
+	minRequests int
+	window      time.Duration
+	cooldown    time.Duration
+	state       BreakerState
+	openedAt    time.Time
+	outcomes    []breakerOutcome
+	probe       *Request
+	now         func() time.Time
+}
+
+// breakerOutcome is the result of a request sent while the breaker is closed
+type breakerOutcome struct {
+	at     time.Time
+	failed bool
+}
+
+// NewBreaker initializes a closed Breaker which opens when at least minRequests
+// were sent in the last window and the ratio of failures among them reaches
+// threshold, between 0 and 1. Once open, it waits for cooldown before letting a
+// probe request through.
+func NewBreaker(threshold float64, minRequests int, window time.Duration, cooldown time.Duration) (*Breaker, error) {
+	if threshold <= 0 || threshold > 1 {
+		return nil, fmt.Errorf("threshold must be greater than 0 and not greater than 1")
+	}
+	if minRequests <= 0 {
+		return nil, fmt.Errorf("minRequests must be greater than zero")
+	}
+	if window <= 0 {
+		return nil, fmt.Errorf("window must be greater than zero")
+	}
+	if cooldown <= 0 {
+		return nil, fmt.Errorf("cooldown must be greater than zero")
+	}
+	return &Breaker{
+		threshold:   threshold,
+		minRequests: minRequests,
+		window:      window,
+		cooldown:    cooldown,
+		now:         time.Now,
+	}, nil
+}
+
+// State returns the current state of the breaker.
+func (b *Breaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.current(b.now())
+}
+
+// current returns the state, which becomes half-open once the cooldown elapses
+func (b *Breaker) current(now time.Time) BreakerState {
+	if b.state == BreakerOpen && !now.Before(b.openedAt.Add(b.cooldown)) {
+		b.state = BreakerHalfOpen
+	}
+	if b.probe != nil && b.probe.Ctx.Err() != nil {
+		// the probe was abandoned before being sent
+		b.probe = nil
+	}
+	return b.state
+}
+
+// check fails fast the requests that would be rejected by the breaker, so that
+// Queue does not enqueue them
+func (b *Breaker) check() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.current(b.now()) {
+	case BreakerOpen:
+		return ErrBreakerOpen
+	case BreakerHalfOpen:
+		if b.probe != nil {
+			return ErrBreakerOpen
+		}
+	}
+	return nil
+}
+
+// admit rejects the queued requests while the breaker is open, and lets the
+// first one through as probe when it is half-open
+func (b *Breaker) admit(req *Request) (time.Time, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.current(b.now()) {
+	case BreakerOpen:
+		return time.Time{}, ErrBreakerOpen
+	case BreakerHalfOpen:
+		if b.probe != nil && b.probe != req {
+			return time.Time{}, ErrBreakerOpen
+		}
+		b.probe = req
+	}
+	return time.Time{}, nil
+}
+
+// reserve rejects the reservations unless the breaker is closed, since they can
+// not probe the provider
+func (b *Breaker) reserve(at time.Time, req *Request) (time.Time, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.current(b.now()) != BreakerClosed {
+		return time.Time{}, ErrBreakerOpen
+	}
+	return at, nil
+}
+
+// record counts the result of a sent request and updates the state
+func (b *Breaker) record(req *Request, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	if b.probe == req {
+		b.probe = nil
+		if failed {
+			b.open(now)
+		} else {
+			b.state = BreakerClosed
+			b.outcomes = nil
+		}
+		return
+	}
+	if b.state != BreakerClosed {
+		return
+	}
+
+	b.outcomes = append(b.outcomes, breakerOutcome{at: now, failed: failed})
+	start := now.Add(-b.window)
+	i := 0
+	for i < len(b.outcomes) && !b.outcomes[i].at.After(start) {
+		i++
+	}
+	b.outcomes = b.outcomes[i:]
+
+	if len(b.outcomes) < b.minRequests {
+		return
+	}
+	failures := 0
+	for _, o := range b.outcomes {
+		if o.failed {
+			failures++
+		}
+	}
+	if float64(failures) >= b.threshold*float64(len(b.outcomes)) {
+		b.open(now)
+	}
+}
+
+// open opens the breaker and forgets the counted results
+func (b *Breaker) open(now time.Time) {
+	b.state = BreakerOpen
+	b.openedAt = now
+	b.outcomes = nil
+}
+
+// breakerSender records the result of every sent request in the breaker
+type breakerSender struct {
+	next    sender
+	breaker *Breaker
+}
+
+func (s *breakerSender) send(req *Request) *Response {
+	res := s.next.send(req)
+	failed := res.Err != nil || (res.HRes != nil && res.HRes.StatusCode >= http.StatusInternalServerError)
+	s.breaker.record(req, failed)
+	return res
+}
@@ -0,0 +1,174 @@
+package throttler_test
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/centraldereservas/throttler"
+)
+
+func TestNewBreaker(t *testing.T) {
+	tt := []struct {
+		name        string
+		threshold   float64
+		minRequests int
+		window      time.Duration
+		cooldown    time.Duration
+		errMsg      string
+	}{
+		{"Positive TC", 0.5, 10, time.Minute, time.Second, ""},
+		{"Positive TC: threshold 1", 1, 1, time.Minute, time.Second, ""},
+		{"Negative TC: threshold zero", 0, 10, time.Minute, time.Second, "threshold must be greater than 0 and not greater than 1"},
+		{"Negative TC: threshold greater than 1", 1.5, 10, time.Minute, time.Second, "threshold must be greater than 0 and not greater than 1"},
+		{"Negative TC: minRequests zero", 0.5, 0, time.Minute, time.Second, "minRequests must be greater than zero"},
+		{"Negative TC: window zero", 0.5, 10, 0, time.Second, "window must be greater than zero"},
+		{"Negative TC: cooldown zero", 0.5, 10, time.Minute, 0, "cooldown must be greater than zero"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := throttler.NewBreaker(tc.threshold, tc.minRequests, tc.window, tc.cooldown)
+			checkError(tc.errMsg, err, t)
+		})
+	}
+}
+
+func TestWithBreaker(t *testing.T) {
+	rate, _ := throttler.NewRateByCallsPerSecond(10, 0)
+	_, err := throttler.New(rate, 5, nil, false, throttler.WithBreaker(nil))
+	checkError("breaker can not be nil", err, t)
+}
+
+// newBreakerClient returns an http.Client answering with the status stored in
+// status once hold is done
+func newBreakerClient(status *int32, hold *sync.WaitGroup) *http.Client {
+	return &http.Client{
+		Transport: &MockTransport{
+			RoundTripMock: func(req *http.Request) (*http.Response, error) {
+				hold.Wait()
+				return newMockClient(int(atomic.LoadInt32(status))).Transport.RoundTrip(req)
+			},
+		},
+	}
+}
+
+func queueStatus(limiter throttler.Limiter) (int, error) {
+	req, _ := http.NewRequest("GET", "http://example.com/", nil)
+	res, err := limiter.Queue(context.Background(), "request", req, duration10s)
+	if err != nil {
+		return 0, err
+	}
+	res.Body.Close()
+	return res.StatusCode, nil
+}
+
+func TestBreakerStates(t *testing.T) {
+	status := int32(http.StatusServiceUnavailable)
+	breaker, _ := throttler.NewBreaker(0.5, 4, time.Minute, 200*time.Millisecond)
+	rate, _ := throttler.NewRateByCallsPerSecond(100, 0)
+	limiter, _ := throttler.New(rate, 5, newBreakerClient(&status, &sync.WaitGroup{}), false, throttler.WithBreaker(breaker))
+	limiter.Run()
+
+	// a success and 3 failures reach the threshold after the minimal requests
+	atomic.StoreInt32(&status, http.StatusOK)
+	queueStatus(limiter)
+	atomic.StoreInt32(&status, http.StatusServiceUnavailable)
+	for i := 0; i < 3; i++ {
+		if code, err := queueStatus(limiter); err != nil || code != http.StatusServiceUnavailable {
+			t.Fatalf("expected status %d; got %d, %v", http.StatusServiceUnavailable, code, err)
+		}
+	}
+	if s := limiter.State().Breaker; s != throttler.BreakerOpen {
+		t.Fatalf("expected the breaker to be open; got %v", s)
+	}
+	if _, err := queueStatus(limiter); err != throttler.ErrBreakerOpen {
+		t.Errorf("expected error %v; got %v", throttler.ErrBreakerOpen, err)
+	}
+
+	// a failed probe opens the breaker again
+	time.Sleep(200 * time.Millisecond)
+	if s := breaker.State(); s != throttler.BreakerHalfOpen {
+		t.Fatalf("expected the breaker to be half open; got %v", s)
+	}
+	if code, err := queueStatus(limiter); err != nil || code != http.StatusServiceUnavailable {
+		t.Errorf("expected the probe to be sent; got %d, %v", code, err)
+	}
+	if s := breaker.State(); s != throttler.BreakerOpen {
+		t.Fatalf("expected the breaker to be open; got %v", s)
+	}
+
+	// a successful probe closes the breaker
+	time.Sleep(200 * time.Millisecond)
+	atomic.StoreInt32(&status, http.StatusOK)
+	if code, err := queueStatus(limiter); err != nil || code != http.StatusOK {
+		t.Errorf("expected the probe to be sent; got %d, %v", code, err)
+	}
+	if s := breaker.State(); s != throttler.BreakerClosed {
+		t.Errorf("expected the breaker to be closed; got %v", s)
+	}
+}
+
+func TestBreakerProbe(t *testing.T) {
+	status := int32(http.StatusInternalServerError)
+	var hold sync.WaitGroup
+	breaker, _ := throttler.NewBreaker(1, 1, time.Minute, 100*time.Millisecond)
+	rate, _ := throttler.NewRateByCallsPerSecond(100, 0)
+	limiter, _ := throttler.New(rate, 5, newBreakerClient(&status, &hold), false, throttler.WithBreaker(breaker))
+	limiter.Run()
+	queueStatus(limiter)
+	time.Sleep(100 * time.Millisecond)
+
+	// only one probe is sent while the breaker is half open
+	atomic.StoreInt32(&status, http.StatusOK)
+	hold.Add(1)
+	done := make(chan error, 1)
+	go func() {
+		_, err := queueStatus(limiter)
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if _, err := queueStatus(limiter); err != throttler.ErrBreakerOpen {
+		t.Errorf("expected error %v while probing; got %v", throttler.ErrBreakerOpen, err)
+	}
+	hold.Done()
+	if err := <-done; err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if code, err := queueStatus(limiter); err != nil || code != http.StatusOK {
+		t.Errorf("expected the breaker to be closed; got %d, %v", code, err)
+	}
+}
+
+func TestBreakerQueued(t *testing.T) {
+	status := int32(http.StatusBadGateway)
+	breaker, _ := throttler.NewBreaker(1, 1, time.Minute, time.Minute)
+	rate, _ := throttler.NewRateByCallsPerSecond(5, 0)
+	limiter, _ := throttler.New(rate, 5, newBreakerClient(&status, &sync.WaitGroup{}), false, throttler.WithBreaker(breaker))
+	limiter.Run()
+
+	// the requests queued before the breaker opens fail without waiting their turn
+	start := time.Now()
+	var wg sync.WaitGroup
+	var rejected int32
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := queueStatus(limiter); err == throttler.ErrBreakerOpen {
+				atomic.AddInt32(&rejected, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if rejected < 3 {
+		t.Errorf("expected at least 3 requests rejected by the breaker; got %d", rejected)
+	}
+	// sending the 5 requests at 5 calls per second would take a second
+	if d := time.Since(start); d > 600*time.Millisecond {
+		t.Errorf("expected the queued requests to fail fast; took %v", d)
+	}
+}
@@ -35,6 +35,7 @@ func createRequest() *Request {
 		Name:    "test request",
 		Timeout: 5 * time.Second,
 		ResChan: resChan,
+		Cost:    1,
 	}
 	return req
 }
@@ -0,0 +1,93 @@
+// Command throttler-proxy is a throttling HTTP proxy, which sends every request
+// through a throttler per upstream host so all the outbound traffic of a
+// network is rate-limited centrally.
+//
+//	throttler-proxy -addr :8080 -rate 10/s -host-rate api.supplier.com=120/min+50ms
+//	HTTP_PROXY=http://localhost:8080 legacy-client
+//
+// With -upstream it works as a reverse proxy, sending the requests with a
+// relative URL to the given upstream.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/centraldereservas/throttler"
+)
+
+// hostRates collects the repeated -host-rate flags
+type hostRates map[string]string
+
+func (h hostRates) String() string {
+	var s []string
+	for host, rate := range h {
+		s = append(s, host+"="+rate)
+	}
+	return strings.Join(s, ",")
+}
+
+func (h hostRates) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return fmt.Errorf("invalid host rate %q, expected host=rate", value)
+	}
+	if _, err := throttler.ParseRate(parts[1]); err != nil {
+		return fmt.Errorf("invalid host rate %q: %v", value, err)
+	}
+	h[parts[0]] = parts[1]
+	return nil
+}
+
+func main() {
+	rates := hostRates{}
+	addr := flag.String("addr", ":8080", "address to listen on")
+	rate := flag.String("rate", "10/s", "rate of the hosts without -host-rate")
+	flag.Var(rates, "host-rate", "rate of a host as host=rate, e.g. api.supplier.com=120/min (repeatable)")
+	upstream := flag.String("upstream", "", "upstream URL of the requests with a relative URL (reverse proxy mode)")
+	capacity := flag.Int("capacity", 100, "capacity of the requests channel of every host")
+	timeout := flag.Duration("timeout", 30*time.Second, "timeout of every request, including the time waiting for its turn")
+	maxHosts := flag.Int("max-hosts", 1000, "maximal number of hosts with a throttler, the least recently used one is closed beyond it")
+	flag.Parse()
+
+	if _, err := throttler.ParseRate(*rate); err != nil {
+		log.Fatal(err)
+	}
+	var up *url.URL
+	if *upstream != "" {
+		u, err := url.Parse(*upstream)
+		if err != nil {
+			log.Fatal(err)
+		}
+		up = u
+	}
+
+	// the redirects are returned to the clients
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	limiterFor := func(host string) (throttler.Limiter, error) {
+		r, ok := rates[host]
+		if !ok {
+			r = *rate
+		}
+		rate, err := throttler.ParseRate(r)
+		if err != nil {
+			return nil, err
+		}
+		return throttler.New(rate, *capacity, client, false)
+	}
+	proxy, err := throttler.NewProxy(limiterFor, up, *timeout, *maxHosts)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("throttler-proxy listening on %v", *addr)
+	log.Fatal(http.ListenAndServe(*addr, proxy))
+}
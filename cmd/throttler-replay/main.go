@@ -0,0 +1,225 @@
+// Command throttler-replay sends the requests read from a JSON lines file through
+// the throttler and writes a JSON line with the result of every request, so bulk
+// operations never exceed the rate of the supplier.
+//
+//	throttler-replay -rate 10/s -in requests.jsonl -out results.jsonl
+//
+// Every input line describes a request:
+//
+//	{"name":"fix-1","method":"POST","url":"https://api.example.com/bookings/1","headers":{"Content-Type":"application/json"},"body":{"status":"confirmed"}}
+//
+// The body is either a JSON string, sent as it is, or any other JSON value, sent
+// as its JSON encoding. Every output line contains the line number, name, status,
+// latency and response body, or the error. The command exits with status 1 if
+// any line is invalid or any request fails, including the responses with a
+// status outside 2xx.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/centraldereservas/throttler"
+)
+
+// input is a line of the input file
+type input struct {
+	Name    string            `json:"name"`
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+	Body    json.RawMessage   `json:"body"`
+}
+
+// output is a line of the output file
+type output struct {
+	Line      int     `json:"line"`
+	Name      string  `json:"name,omitempty"`
+	Status    int     `json:"status,omitempty"`
+	LatencyMs float64 `json:"latency_ms"`
+	Body      string  `json:"body,omitempty"`
+	Error     string  `json:"error,omitempty"`
+}
+
+func main() {
+	in := flag.String("in", "-", "input JSON lines file, - for stdin")
+	out := flag.String("out", "-", "output JSON lines file, - for stdout")
+	rateFlag := flag.String("rate", "1/s", "rate of the requests, e.g. 10/s or 120/min+50ms")
+	strategy := flag.String("strategy", "", "scheduling strategy: leaky_bucket, sliding_window_log, sliding_window_counter or gcra")
+	burst := flag.Int("burst", 1, "burst of the gcra strategy")
+	concurrency := flag.Int("concurrency", 10, "maximal number of requests in flight")
+	timeout := flag.Duration("timeout", 30*time.Second, "timeout of every request, including the time waiting for its turn")
+	flag.Parse()
+
+	if *concurrency <= 0 {
+		log.Fatal("concurrency must be greater than zero")
+	}
+	cfg := &throttler.Config{Rate: *rateFlag, Strategy: *strategy, Burst: *burst, ReqChanCapacity: *concurrency}
+	client := &http.Client{Transport: timingTransport{http.DefaultTransport}}
+	t, err := throttler.NewFromConfig(cfg, client)
+	if err != nil {
+		log.Fatal(err)
+	}
+	t.Run()
+
+	r, err := openInput(*in)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer r.Close()
+	w, err := openOutput(*out)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer w.Close()
+
+	if failed := replay(t, r, w, *concurrency, *timeout); failed > 0 {
+		w.Close()
+		log.Fatalf("%d request(s) failed", failed)
+	}
+}
+
+// failed reports whether the request failed or was answered with a status outside 2xx
+func (o output) failed() bool {
+	return o.Error != "" || o.Status < 200 || o.Status > 299
+}
+
+// replay sends the requests of r and writes the results to w. It returns the
+// number of requests which failed.
+func replay(t throttler.Limiter, r io.Reader, w io.Writer, concurrency int, timeout time.Duration) int {
+	var mu sync.Mutex
+	enc := json.NewEncoder(w)
+	failed := 0
+	write := func(o output) {
+		mu.Lock()
+		defer mu.Unlock()
+		if o.failed() {
+			failed++
+		}
+		enc.Encode(o)
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 64<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var in input
+		if err := json.Unmarshal(scanner.Bytes(), &in); err != nil {
+			write(output{Line: line, Error: fmt.Sprintf("invalid line: %v", err)})
+			continue
+		}
+		hreq, err := in.request()
+		if err != nil {
+			write(output{Line: line, Name: in.Name, Error: err.Error()})
+			continue
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(line int, name string, hreq *http.Request) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			write(send(t, line, name, hreq, timeout))
+		}(line, in.Name, hreq)
+	}
+	if err := scanner.Err(); err != nil {
+		write(output{Error: fmt.Sprintf("unable to read the input: %v", err)})
+	}
+	wg.Wait()
+	return failed
+}
+
+// startKey is the context key of the time when the request is dispatched
+type startKey struct{}
+
+// timingTransport saves the time when the request is dispatched in the
+// *time.Time stored in its context, so the latency does not include the time
+// waiting for the turn in the throttler
+type timingTransport struct {
+	next http.RoundTripper
+}
+
+func (t timingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if start, ok := req.Context().Value(startKey{}).(*time.Time); ok {
+		*start = time.Now()
+	}
+	return t.next.RoundTrip(req)
+}
+
+// send queues the request and measures the latency since it is dispatched
+func send(t throttler.Limiter, line int, name string, hreq *http.Request, timeout time.Duration) output {
+	var start time.Time
+	ctx := context.WithValue(context.Background(), startKey{}, &start)
+	o := output{Line: line, Name: name}
+	hreq = hreq.WithContext(ctx)
+	res, err := t.Queue(ctx, name, hreq, timeout)
+	if err != nil {
+		o.Error = err.Error()
+		return o
+	}
+	defer res.Body.Close()
+	o.LatencyMs = float64(time.Since(start)) / float64(time.Millisecond)
+	o.Status = res.StatusCode
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		o.Error = fmt.Sprintf("unable to read the response body: %v", err)
+	}
+	o.Body = string(body)
+	return o
+}
+
+// request builds the http.Request of the input line
+func (in input) request() (*http.Request, error) {
+	if in.URL == "" {
+		return nil, fmt.Errorf("url can not be empty")
+	}
+	method := in.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	var body []byte
+	if len(in.Body) > 0 && string(in.Body) != "null" {
+		var s string
+		if err := json.Unmarshal(in.Body, &s); err == nil {
+			body = []byte(s)
+		} else {
+			body = in.Body
+		}
+	}
+	hreq, err := http.NewRequest(method, in.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range in.Headers {
+		hreq.Header.Set(k, v)
+	}
+	return hreq, nil
+}
+
+func openInput(path string) (io.ReadCloser, error) {
+	if path == "-" {
+		return ioutil.NopCloser(os.Stdin), nil
+	}
+	return os.Open(path)
+}
+
+func openOutput(path string) (io.WriteCloser, error) {
+	if path == "-" {
+		return os.Stdout, nil
+	}
+	return os.Create(path)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/centraldereservas/throttler"
+)
+
+func TestInputRequest(t *testing.T) {
+	tt := []struct {
+		name   string
+		line   string
+		method string
+		body   string
+		header string
+		errMsg string
+	}{
+		{"Positive TC: default method", `{"url":"http://example.com/a"}`, "GET", "", "", ""},
+		{"Positive TC: string body", `{"method":"POST","url":"http://example.com/a","body":"a=1&b=2"}`, "POST", "a=1&b=2", "", ""},
+		{"Positive TC: JSON body", `{"method":"PUT","url":"http://example.com/a","body":{"status":"confirmed"}}`, "PUT", `{"status":"confirmed"}`, "", ""},
+		{"Positive TC: null body", `{"url":"http://example.com/a","body":null}`, "GET", "", "", ""},
+		{"Positive TC: headers", `{"url":"http://example.com/a","headers":{"X-Id":"42"}}`, "GET", "", "42", ""},
+		{"Negative TC: empty url", `{"name":"a"}`, "", "", "", "url can not be empty"},
+		{"Negative TC: invalid method", `{"method":"BAD METHOD","url":"http://example.com/a"}`, "", "", "", `net/http: invalid method "BAD METHOD"`},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var in input
+			if err := json.Unmarshal([]byte(tc.line), &in); err != nil {
+				t.Fatalf("invalid line: %v", err)
+			}
+			hreq, err := in.request()
+			if err != nil {
+				if err.Error() != tc.errMsg {
+					t.Errorf("expected error message: %v; got: %v", tc.errMsg, err)
+				}
+				return
+			}
+			if tc.errMsg != "" {
+				t.Fatalf("expected error message: %v", tc.errMsg)
+			}
+			body, _ := ioutil.ReadAll(hreq.Body)
+			if hreq.Method != tc.method || string(body) != tc.body || hreq.Header.Get("X-Id") != tc.header {
+				t.Errorf("unexpected request %v %s %v", hreq.Method, body, hreq.Header)
+			}
+		})
+	}
+}
+
+func TestReplay(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok":
+			w.Write([]byte("done"))
+		case "/missing":
+			http.NotFound(w, r)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	tt := []struct {
+		name     string
+		paths    []string
+		failed   int
+		statuses []int
+	}{
+		{"Positive TC: all succeed", []string{"/ok", "/ok"}, 0, []int{200, 200}},
+		{"Negative TC: 4xx and 5xx fail", []string{"/ok", "/missing", "/error"}, 2, []int{200, 404, 500}},
+		{"Negative TC: invalid lines fail", []string{"/ok", ""}, 1, []int{0, 200}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var in bytes.Buffer
+			for i, path := range tc.paths {
+				if path == "" {
+					in.WriteString("{not json\n")
+					continue
+				}
+				json.NewEncoder(&in).Encode(input{Name: strings.Repeat("r", i+1), URL: server.URL + path})
+			}
+			rate, _ := throttler.NewRateByCallsPerSecond(100, 0)
+			limiter, _ := throttler.New(rate, 2, nil, false)
+			limiter.Run()
+
+			var out bytes.Buffer
+			if failed := replay(limiter, &in, &out, 2, time.Second); failed != tc.failed {
+				t.Errorf("expected %d failed requests; got %d", tc.failed, failed)
+			}
+			var statuses []int
+			for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+				var o output
+				if err := json.Unmarshal([]byte(line), &o); err != nil {
+					t.Fatalf("invalid output line %q: %v", line, err)
+				}
+				statuses = append(statuses, o.Status)
+			}
+			sort.Ints(statuses)
+			if len(statuses) != len(tc.statuses) {
+				t.Fatalf("expected statuses %v; got %v", tc.statuses, statuses)
+			}
+			for i := range statuses {
+				if statuses[i] != tc.statuses[i] {
+					t.Errorf("expected statuses %v; got %v", tc.statuses, statuses)
+					break
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+// Command throttlerd is a local throttling daemon which owns the rate limits of
+// a host and grants slots to other processes through a Unix socket or a
+// loopback HTTP address.
+//
+//	throttlerd -socket /run/throttlerd.sock -limit search=10/s -limit booking=120/min+50ms
+//	curl --unix-socket /run/throttlerd.sock -X POST 'http://throttler/acquire?limit=search'
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/centraldereservas/throttler"
+)
+
+// limitFlags collects the repeated -limit flags
+type limitFlags []string
+
+func (l *limitFlags) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *limitFlags) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+func main() {
+	var limits limitFlags
+	socket := flag.String("socket", "", "path of the Unix socket to listen on")
+	addr := flag.String("addr", "", "loopback address to listen on (e.g. 127.0.0.1:7070) instead of a Unix socket")
+	flag.Var(&limits, "limit", "limit to serve as name=rate, e.g. search=10/s (repeatable)")
+	flag.Parse()
+
+	limiters, err := buildLimiters(limits)
+	if err != nil {
+		log.Fatal(err)
+	}
+	handler, err := throttler.NewDaemonHandler(limiters)
+	if err != nil {
+		log.Fatal(err)
+	}
+	ln, err := listen(*socket, *addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	server := &http.Server{Handler: handler}
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+		<-sig
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	}()
+	log.Printf("throttlerd listening on %v", ln.Addr())
+	if err := server.Serve(ln); err != nil && err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+}
+
+// buildLimiters creates a throttler for every name=rate flag
+func buildLimiters(limits []string) (map[string]throttler.Limiter, error) {
+	if len(limits) == 0 {
+		return nil, fmt.Errorf("at least one -limit is required")
+	}
+	limiters := make(map[string]throttler.Limiter)
+	for _, l := range limits {
+		parts := strings.SplitN(l, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid limit %q, expected name=rate", l)
+		}
+		rate, err := throttler.ParseRate(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid limit %q: %v", l, err)
+		}
+		t, err := throttler.New(rate, 0, nil, false)
+		if err != nil {
+			return nil, err
+		}
+		limiters[parts[0]] = t
+	}
+	return limiters, nil
+}
+
+// listen opens the Unix socket, replacing a stale one, or the loopback address
+func listen(socket string, addr string) (net.Listener, error) {
+	if (socket == "") == (addr == "") {
+		return nil, fmt.Errorf("either -socket or -addr is required")
+	}
+	if socket != "" {
+		if fi, err := os.Lstat(socket); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			os.Remove(socket)
+		}
+		return net.Listen("unix", socket)
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return nil, fmt.Errorf("addr must be a loopback address")
+	}
+	return net.Listen("tcp", addr)
+}
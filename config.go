@@ -0,0 +1,267 @@
+package throttler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Duration is a time.Duration that is read from and written to configuration
+// files as a string like "1m30s".
+type Duration time.Duration
+
+// UnmarshalJSON parses a duration string or a number of nanoseconds
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	switch value := v.(type) {
+	case float64:
+		*d = Duration(value)
+	case string:
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		*d = Duration(parsed)
+	default:
+		return fmt.Errorf("invalid duration %v", v)
+	}
+	return nil
+}
+
+// MarshalJSON writes the duration as a string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Config contains the throttler configuration loaded by LoadConfig.
+type Config struct {
+	// Rate is parsed with ParseRate, e.g. "120/min+50ms"
+	Rate string `json:"rate"`
+
+	// ReqChanCapacity is the capacity of the requests channel
+	ReqChanCapacity int `json:"req_chan_capacity"`
+
+	// Verbose displays debug information in the standard output
+	Verbose bool `json:"verbose"`
+
+	// Strategy is "leaky_bucket" (default), "sliding_window_log", "sliding_window_counter" or "gcra"
+	Strategy string `json:"strategy"`
+
+	// Burst is the number of requests the gcra strategy can dispatch at once
+	Burst int `json:"burst"`
+
+	// ClientTimeout is the timeout of the http.Client created by NewFromConfig
+	ClientTimeout Duration `json:"client_timeout"`
+
+	// RequestTimeout is the timeout used by Queue when it is called with a timeout of zero
+	RequestTimeout Duration `json:"request_timeout"`
+
+	// Schedule contains the rules of a scheduled rate, where Rate is the fallback
+	Schedule []ScheduleConfig `json:"schedule"`
+
+	// Quota enables the quota of the throttler
+	Quota *QuotaConfig `json:"quota"`
+}
+
+// ScheduleConfig is the configuration of a ScheduleRule.
+type ScheduleConfig struct {
+	// Days are weekday names like "mon" or "monday"; every day if empty
+	Days []string `json:"days"`
+
+	// Start and End are clock times like "08:00"
+	Start string `json:"start"`
+	End   string `json:"end"`
+
+	// Location is an IANA time zone name like "Europe/Madrid"
+	Location string `json:"location"`
+
+	// Rate is parsed with ParseRate
+	Rate string `json:"rate"`
+}
+
+// QuotaConfig is the configuration of a Quota.
+type QuotaConfig struct {
+	Limit int `json:"limit"`
+
+	// Period is "daily" or "monthly"
+	Period string `json:"period"`
+
+	// Policy is "reject" or "delay"
+	Policy string `json:"policy"`
+
+	// Location is an IANA time zone name like "Europe/Madrid"
+	Location string `json:"location"`
+
+	// Path is the file where the counter is persisted
+	Path string `json:"path"`
+}
+
+var strategies = map[string]Strategy{
+	"":                       LeakyBucket,
+	"leaky_bucket":           LeakyBucket,
+	"sliding_window_log":     SlidingWindowLog,
+	"sliding_window_counter": SlidingWindowCounter,
+	"gcra":                   GCRA,
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday,
+	"tue": time.Tuesday, "tuesday": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday,
+	"thu": time.Thursday, "thursday": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday,
+}
+
+// LoadConfig reads the throttler configuration from a JSON file, or from a
+// YAML file if its extension is .yaml or .yml.
+func LoadConfig(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the config file: %v", err)
+	}
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == ".yaml" || ext == ".yml" {
+		v, err := decodeYAML(data)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse the config file: %v", err)
+		}
+		if data, err = json.Marshal(v); err != nil {
+			return nil, fmt.Errorf("unable to parse the config file: %v", err)
+		}
+	}
+	cfg := &Config{}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("unable to parse the config file: %v", err)
+	}
+	return cfg, nil
+}
+
+// NewFromConfig initializes the throttler handler described by the configuration.
+// If client is nil an http.Client with the configured ClientTimeout is used, and
+// the configured RequestTimeout is used by Queue when it is called with a timeout
+// of zero.
+func NewFromConfig(cfg *Config, client *http.Client, opts ...Option) (Limiter, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("config can not be nil")
+	}
+	rate, err := cfg.BuildRate()
+	if err != nil {
+		return nil, err
+	}
+	strategy, ok := strategies[strings.ToLower(cfg.Strategy)]
+	if !ok {
+		return nil, fmt.Errorf("unknown strategy %q", cfg.Strategy)
+	}
+	opts = append([]Option{WithStrategy(strategy)}, opts...)
+	if cfg.Burst != 0 {
+		opts = append([]Option{WithBurst(cfg.Burst)}, opts...)
+	}
+	if cfg.RequestTimeout != 0 {
+		opts = append([]Option{WithRequestTimeout(time.Duration(cfg.RequestTimeout))}, opts...)
+	}
+	if cfg.Quota != nil {
+		quota, err := cfg.Quota.build()
+		if err != nil {
+			return nil, err
+		}
+		opts = append([]Option{WithQuota(quota)}, opts...)
+	}
+	if client == nil {
+		client = &http.Client{Timeout: time.Duration(cfg.ClientTimeout)}
+	}
+	return New(rate, cfg.ReqChanCapacity, client, cfg.Verbose, opts...)
+}
+
+// BuildRate returns the Rate described by the configuration, which is a
+// scheduled rate if it contains schedule rules.
+func (cfg *Config) BuildRate() (Rate, error) {
+	rate, err := ParseRate(cfg.Rate)
+	if err != nil {
+		return nil, err
+	}
+	if len(cfg.Schedule) == 0 {
+		return rate, nil
+	}
+	rules := make([]ScheduleRule, 0, len(cfg.Schedule))
+	for _, sc := range cfg.Schedule {
+		rule, err := sc.build()
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return NewScheduledRate(rate, rules...)
+}
+
+func (sc ScheduleConfig) build() (ScheduleRule, error) {
+	rule := ScheduleRule{}
+	for _, name := range sc.Days {
+		day, ok := weekdays[strings.ToLower(name)]
+		if !ok {
+			return rule, fmt.Errorf("unknown weekday %q", name)
+		}
+		rule.Days = append(rule.Days, day)
+	}
+	var err error
+	if rule.Start, err = parseClock(sc.Start); err != nil {
+		return rule, err
+	}
+	if rule.End, err = parseClock(sc.End); err != nil {
+		return rule, err
+	}
+	if rule.Location, err = loadLocation(sc.Location); err != nil {
+		return rule, err
+	}
+	rule.Rate, err = ParseRate(sc.Rate)
+	return rule, err
+}
+
+func (qc *QuotaConfig) build() (*Quota, error) {
+	periods := map[string]QuotaPeriod{"daily": Daily, "monthly": Monthly}
+	period, ok := periods[strings.ToLower(qc.Period)]
+	if !ok {
+		return nil, fmt.Errorf("unknown quota period %q", qc.Period)
+	}
+	policies := map[string]QuotaPolicy{"": QuotaReject, "reject": QuotaReject, "delay": QuotaDelay}
+	policy, ok := policies[strings.ToLower(qc.Policy)]
+	if !ok {
+		return nil, fmt.Errorf("unknown quota policy %q", qc.Policy)
+	}
+	location, err := loadLocation(qc.Location)
+	if err != nil {
+		return nil, err
+	}
+	return NewQuota(qc.Limit, period, policy, location, qc.Path)
+}
+
+// parseClock converts a clock time like "08:30" into the offset from midnight
+func parseClock(s string) (time.Duration, error) {
+	if s == "24:00" {
+		return 24 * time.Hour, nil
+	}
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid clock time %q", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func loadLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return nil, nil
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown location %q", name)
+	}
+	return location, nil
+}
@@ -0,0 +1,152 @@
+package throttler_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/centraldereservas/throttler"
+)
+
+const jsonConfig = `{
+	"rate": "120/min+50ms",
+	"req_chan_capacity": 20,
+	"client_timeout": "30s",
+	"request_timeout": "10s",
+	"schedule": [
+		{"days": ["sat", "sun"], "start": "00:00", "end": "24:00", "location": "UTC", "rate": "240/min"}
+	],
+	"quota": {"limit": 1000, "period": "daily", "policy": "delay", "location": "UTC"}
+}`
+
+const yamlConfig = `# supplier limits
+rate: 120/min+50ms
+req_chan_capacity: 20
+client_timeout: "30s"  # per call to the provider
+request_timeout: 10s
+schedule:
+  - days: [sat, sun]
+    start: "00:00"
+    end: "24:00"
+    location: UTC
+    rate: 240/min
+quota:
+  limit: 1000
+  period: daily
+  policy: delay
+  location: UTC
+`
+
+func writeConfig(t *testing.T, dir string, name string, content string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("unable to write the config file: %v", err)
+	}
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatalf("unable to create a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	tt := []struct {
+		name     string
+		fileName string
+		content  string
+		errMsg   string
+	}{
+		{"Positive TC: json", "throttler.json", jsonConfig, ""},
+		{"Positive TC: yaml", "throttler.yaml", yamlConfig, ""},
+		{"Negative TC: invalid json", "invalid.json", "{", "unable to parse the config file: unexpected end of JSON input"},
+		{"Negative TC: invalid yaml", "invalid.yml", "rate 2/s", "unable to parse the config file: yaml line 1: expected key: value"},
+		{"Negative TC: invalid duration", "duration.json", `{"client_timeout": "soon"}`, `unable to parse the config file: time: invalid duration "soon"`},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			path := writeConfig(t, dir, tc.fileName, tc.content)
+			cfg, err := throttler.LoadConfig(path)
+			if checkError(tc.errMsg, err, t) {
+				return
+			}
+			if cfg.Rate != "120/min+50ms" {
+				t.Errorf("unexpected rate: %v", cfg.Rate)
+			}
+			if cfg.ReqChanCapacity != 20 {
+				t.Errorf("unexpected req_chan_capacity: %v", cfg.ReqChanCapacity)
+			}
+			if time.Duration(cfg.ClientTimeout) != 30*time.Second || time.Duration(cfg.RequestTimeout) != duration10s {
+				t.Errorf("unexpected timeouts: %v, %v", cfg.ClientTimeout, cfg.RequestTimeout)
+			}
+			if len(cfg.Schedule) != 1 || len(cfg.Schedule[0].Days) != 2 || cfg.Schedule[0].End != "24:00" {
+				t.Errorf("unexpected schedule: %+v", cfg.Schedule)
+			}
+			if cfg.Quota == nil || cfg.Quota.Limit != 1000 || cfg.Quota.Policy != "delay" {
+				t.Errorf("unexpected quota: %+v", cfg.Quota)
+			}
+		})
+	}
+}
+
+func TestNewFromConfig(t *testing.T) {
+	tt := []struct {
+		name         string
+		cfg          *throttler.Config
+		expectedRate time.Duration
+		errMsg       string
+	}{
+		{"Positive TC", &throttler.Config{Rate: "2/s+50ms", ReqChanCapacity: 5}, duration550ms, ""},
+		{"Positive TC: scheduled rate", &throttler.Config{Rate: "2/s", Schedule: []throttler.ScheduleConfig{{Start: "00:00", End: "00:00", Rate: "4/s"}}}, 250 * time.Millisecond, ""},
+		{"Positive TC: quota", &throttler.Config{Rate: "2/s", Quota: &throttler.QuotaConfig{Limit: 10, Period: "monthly"}}, duration500ms, ""},
+		{"Positive TC: strategy", &throttler.Config{Rate: "2/s", Strategy: "sliding_window_log"}, duration500ms, ""},
+		{"Positive TC: gcra with burst", &throttler.Config{Rate: "2/s", Strategy: "gcra", Burst: 4}, duration500ms, ""},
+		{"Positive TC: request timeout", &throttler.Config{Rate: "2/s", RequestTimeout: throttler.Duration(duration10s)}, duration500ms, ""},
+		{"Negative TC: config nil", nil, 0, "config can not be nil"},
+		{"Negative TC: negative burst", &throttler.Config{Rate: "2/s", Strategy: "gcra", Burst: -1}, 0, "burst must be greater than zero"},
+		{"Negative TC: unknown strategy", &throttler.Config{Rate: "2/s", Strategy: "fixed_window"}, 0, `unknown strategy "fixed_window"`},
+		{"Negative TC: invalid rate", &throttler.Config{Rate: "2"}, 0, `invalid rate "2": expected calls/unit`},
+		{"Negative TC: unknown weekday", &throttler.Config{Rate: "2/s", Schedule: []throttler.ScheduleConfig{{Days: []string{"someday"}, Rate: "4/s"}}}, 0, `unknown weekday "someday"`},
+		{"Negative TC: invalid clock", &throttler.Config{Rate: "2/s", Schedule: []throttler.ScheduleConfig{{Start: "8am", Rate: "4/s"}}}, 0, `invalid clock time "8am"`},
+		{"Negative TC: unknown location", &throttler.Config{Rate: "2/s", Quota: &throttler.QuotaConfig{Limit: 10, Period: "daily", Location: "Nowhere/City"}}, 0, `unknown location "Nowhere/City"`},
+		{"Negative TC: unknown quota period", &throttler.Config{Rate: "2/s", Quota: &throttler.QuotaConfig{Limit: 10, Period: "weekly"}}, 0, `unknown quota period "weekly"`},
+		{"Negative TC: unknown quota policy", &throttler.Config{Rate: "2/s", Quota: &throttler.QuotaConfig{Limit: 10, Period: "daily", Policy: "drop"}}, 0, `unknown quota policy "drop"`},
+		{"Negative TC: negative request timeout", &throttler.Config{Rate: "2/s", RequestTimeout: throttler.Duration(-duration10s)}, 0, "request timeout must be greater than zero"},
+		{"Negative TC: negative capacity", &throttler.Config{Rate: "2/s", ReqChanCapacity: -1}, 0, "reqChanCapacity must be greater than zero"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			limiter, err := throttler.NewFromConfig(tc.cfg, nil)
+			if !checkError(tc.errMsg, err, t) {
+				if rateDuration := limiter.Rate(); rateDuration != tc.expectedRate {
+					t.Errorf("expected rate duration %v; got %v", tc.expectedRate, rateDuration)
+				}
+			}
+		})
+	}
+}
+
+func TestNewFromConfigRequestTimeout(t *testing.T) {
+	cfg := &throttler.Config{Rate: "100/s", ReqChanCapacity: 5, RequestTimeout: throttler.Duration(duration10s)}
+	limiter, err := throttler.NewFromConfig(cfg, newMockClient(http.StatusOK))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	limiter.Run()
+	defer limiter.Close()
+
+	// a timeout of zero is replaced by the configured one
+	req, _ := http.NewRequest("GET", "http://example.com/", nil)
+	res, err := limiter.Queue(context.Background(), "default timeout", req, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	res.Body.Close()
+}
@@ -0,0 +1,217 @@
+package throttler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// daemonReply is the JSON body returned by the daemon API
+type daemonReply struct {
+	Limit   string  `json:"limit,omitempty"`
+	DelayMs float64 `json:"delay_ms"`
+	Error   string  `json:"error,omitempty"`
+}
+
+// daemonHandler serves the API of the throttling daemon
+type daemonHandler struct {
+	limiters map[string]Limiter
+}
+
+// NewDaemonHandler returns the http.Handler of the throttling daemon, which grants
+// slots of the named limiters to other processes. The API has two endpoints, both
+// with the limit name and the optional number of units (1 by default) as query
+// parameters:
+//
+//	POST /reserve?limit=search&n=1  books a slot and returns its delay
+//	POST /acquire?limit=search&n=1  blocks until the slot is granted
+//
+// The response body is JSON like {"limit":"search","delay_ms":150}, and
+// GET /limits returns the names and periods of the limiters.
+func NewDaemonHandler(limiters map[string]Limiter) (http.Handler, error) {
+	if len(limiters) == 0 {
+		return nil, fmt.Errorf("limiters can not be empty")
+	}
+	for name, l := range limiters {
+		if l == nil {
+			return nil, fmt.Errorf("limiter %q can not be nil", name)
+		}
+	}
+	return &daemonHandler{limiters: limiters}, nil
+}
+
+func (h *daemonHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/limits":
+		if r.Method != http.MethodGet {
+			writeDaemonError(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed"))
+			return
+		}
+		h.serveLimits(w)
+	case "/reserve", "/acquire":
+		if r.Method != http.MethodPost {
+			writeDaemonError(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed"))
+			return
+		}
+		h.serveSlot(w, r)
+	default:
+		writeDaemonError(w, http.StatusNotFound, fmt.Errorf("unknown endpoint %q", r.URL.Path))
+	}
+}
+
+func (h *daemonHandler) serveLimits(w http.ResponseWriter) {
+	names := make([]string, 0, len(h.limiters))
+	for name := range h.limiters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	limits := make([]map[string]string, 0, len(names))
+	for _, name := range names {
+		limits = append(limits, map[string]string{
+			"limit":  name,
+			"period": h.limiters[name].Rate().String(),
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(limits)
+}
+
+// serveSlot reserves a slot of the limiter and, for /acquire, waits until it is granted
+func (h *daemonHandler) serveSlot(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("limit")
+	l, ok := h.limiters[name]
+	if !ok {
+		writeDaemonError(w, http.StatusNotFound, fmt.Errorf("unknown limit %q", name))
+		return
+	}
+	n := 1
+	if s := r.URL.Query().Get("n"); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil {
+			writeDaemonError(w, http.StatusBadRequest, fmt.Errorf("invalid n %q", s))
+			return
+		}
+		n = v
+	}
+	if n <= 0 {
+		writeDaemonError(w, http.StatusBadRequest, fmt.Errorf("n must be greater than zero"))
+		return
+	}
+
+	// the slot booked by /reserve must survive the request
+	ctx := context.Background()
+	if r.URL.Path == "/acquire" {
+		ctx = r.Context()
+	}
+	res, err := l.Reserve(ctx, n)
+	if err != nil {
+		writeDaemonError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	delay := res.Delay()
+	if r.URL.Path == "/acquire" {
+		if err := res.Commit(); err != nil {
+			writeDaemonError(w, http.StatusServiceUnavailable, err)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(daemonReply{Limit: name, DelayMs: float64(delay) / float64(time.Millisecond)})
+}
+
+func writeDaemonError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(daemonReply{Error: err.Error()})
+}
+
+// daemonTimeout is the time that the throttlers created WithDaemon wait for the
+// daemon to book a slot before rejecting the request
+const daemonTimeout = 5 * time.Second
+
+// DaemonClient acquires slots of a limit from a throttling daemon.
+type DaemonClient struct {
+	client  *http.Client
+	limit   string
+	timeout time.Duration
+}
+
+// NewDaemonClient initializes a client of the limit served by the daemon listening
+// at addr, where network is "unix" for a Unix socket or "tcp" for a loopback address.
+func NewDaemonClient(network string, addr string, limit string) (*DaemonClient, error) {
+	if network != "unix" && network != "tcp" {
+		return nil, fmt.Errorf("network must be unix or tcp")
+	}
+	if addr == "" {
+		return nil, fmt.Errorf("addr can not be empty")
+	}
+	if limit == "" {
+		return nil, fmt.Errorf("limit can not be empty")
+	}
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}
+	return &DaemonClient{client: &http.Client{Transport: transport}, limit: limit, timeout: daemonTimeout}, nil
+}
+
+// Reserve books a slot of n units and returns how long the caller must wait
+// until it is granted.
+func (c *DaemonClient) Reserve(ctx context.Context, n int) (time.Duration, error) {
+	return c.call(ctx, "/reserve", n)
+}
+
+// Acquire blocks until a slot of n units is granted or the context is done.
+func (c *DaemonClient) Acquire(ctx context.Context, n int) error {
+	_, err := c.call(ctx, "/acquire", n)
+	return err
+}
+
+func (c *DaemonClient) call(ctx context.Context, path string, n int) (time.Duration, error) {
+	q := url.Values{"limit": {c.limit}, "n": {strconv.Itoa(n)}}
+	req, err := http.NewRequest(http.MethodPost, "http://throttler"+path+"?"+q.Encode(), bytes.NewReader(nil))
+	if err != nil {
+		return 0, err
+	}
+	res, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return 0, fmt.Errorf("unable to call the daemon: %v", err)
+	}
+	defer res.Body.Close()
+	var reply daemonReply
+	if err := json.NewDecoder(res.Body).Decode(&reply); err != nil {
+		return 0, fmt.Errorf("invalid reply from the daemon: %v", err)
+	}
+	if res.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("daemon error: %v", reply.Error)
+	}
+	return time.Duration(reply.DelayMs * float64(time.Millisecond)), nil
+}
+
+// book reserves a slot of cost units, used by the throttlers created WithDaemon.
+// A daemon which does not answer in time rejects the request, so it does not
+// stall the listener.
+func (c *DaemonClient) book(now time.Time, cost int64) (time.Time, error) {
+	if cost == 0 {
+		return now, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	delay, err := c.Reserve(ctx, int(cost))
+	if ctx.Err() == context.DeadlineExceeded {
+		return time.Time{}, fmt.Errorf("the daemon did not answer within %v", c.timeout)
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return now.Add(delay), nil
+}
@@ -0,0 +1,187 @@
+package throttler_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/centraldereservas/throttler"
+)
+
+func TestNewDaemonHandler(t *testing.T) {
+	rate, _ := throttler.NewRateByCallsPerSecond(10, 0)
+	limiter, _ := throttler.New(rate, 0, nil, false)
+
+	tt := []struct {
+		name     string
+		limiters map[string]throttler.Limiter
+		errMsg   string
+	}{
+		{"Positive TC", map[string]throttler.Limiter{"search": limiter}, ""},
+		{"Negative TC: limiters empty", nil, "limiters can not be empty"},
+		{"Negative TC: limiter nil", map[string]throttler.Limiter{"search": nil}, `limiter "search" can not be nil`},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := throttler.NewDaemonHandler(tc.limiters)
+			checkError(tc.errMsg, err, t)
+		})
+	}
+}
+
+func TestDaemonHandler(t *testing.T) {
+	rate, _ := throttler.NewRateByCallsPerSecond(10, 0)
+	limiter, _ := throttler.New(rate, 0, nil, false)
+	handler, _ := throttler.NewDaemonHandler(map[string]throttler.Limiter{"search": limiter})
+
+	tt := []struct {
+		name   string
+		method string
+		target string
+		status int
+		body   string
+	}{
+		{"Positive TC: limits", "GET", "/limits", http.StatusOK, `[{"limit":"search","period":"100ms"}]`},
+		{"Positive TC: reserve", "POST", "/reserve?limit=search", http.StatusOK, `"limit":"search"`},
+		{"Negative TC: unknown limit", "POST", "/reserve?limit=booking", http.StatusNotFound, `{"delay_ms":0,"error":"unknown limit \"booking\""}`},
+		{"Negative TC: invalid n", "POST", "/acquire?limit=search&n=x", http.StatusBadRequest, `{"delay_ms":0,"error":"invalid n \"x\""}`},
+		{"Negative TC: n negative", "POST", "/reserve?limit=search&n=-2", http.StatusBadRequest, `{"delay_ms":0,"error":"n must be greater than zero"}`},
+		{"Negative TC: n zero", "POST", "/acquire?limit=search&n=0", http.StatusBadRequest, `{"delay_ms":0,"error":"n must be greater than zero"}`},
+		{"Negative TC: method", "GET", "/reserve?limit=search", http.StatusMethodNotAllowed, `{"delay_ms":0,"error":"method not allowed"}`},
+		{"Negative TC: unknown endpoint", "GET", "/", http.StatusNotFound, `{"delay_ms":0,"error":"unknown endpoint \"/\""}`},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(tc.method, tc.target, nil))
+			if w.Code != tc.status {
+				t.Errorf("expected status %d; got %d", tc.status, w.Code)
+			}
+			if !strings.Contains(w.Body.String(), tc.body) {
+				t.Errorf("expected body containing %s; got %s", tc.body, w.Body.String())
+			}
+		})
+	}
+}
+
+// startDaemon serves the daemon API on a Unix socket and returns its path
+func startDaemon(t *testing.T, calls int) (string, func()) {
+	dir, err := ioutil.TempDir("", "throttler")
+	if err != nil {
+		t.Fatalf("unable to create the temp dir: %v", err)
+	}
+	rate, _ := throttler.NewRateByCallsPerSecond(calls, 0)
+	limiter, _ := throttler.New(rate, 0, nil, false)
+	handler, _ := throttler.NewDaemonHandler(map[string]throttler.Limiter{"search": limiter})
+	socket := filepath.Join(dir, "throttlerd.sock")
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	server := &http.Server{Handler: handler}
+	go server.Serve(ln)
+	return socket, func() {
+		server.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestNewDaemonClient(t *testing.T) {
+	tt := []struct {
+		name    string
+		network string
+		addr    string
+		limit   string
+		errMsg  string
+	}{
+		{"Positive TC", "unix", "/run/throttlerd.sock", "search", ""},
+		{"Negative TC: network", "udp", "127.0.0.1:7070", "search", "network must be unix or tcp"},
+		{"Negative TC: addr empty", "tcp", "", "search", "addr can not be empty"},
+		{"Negative TC: limit empty", "unix", "/run/throttlerd.sock", "", "limit can not be empty"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := throttler.NewDaemonClient(tc.network, tc.addr, tc.limit)
+			checkError(tc.errMsg, err, t)
+		})
+	}
+}
+
+func TestDaemonClient(t *testing.T) {
+	socket, stop := startDaemon(t, 10)
+	defer stop()
+	client, _ := throttler.NewDaemonClient("unix", socket, "search")
+
+	var delays []time.Duration
+	for i := 0; i < 3; i++ {
+		d, err := client.Reserve(context.Background(), 1)
+		if err != nil {
+			t.Fatalf("unable to reserve: %v", err)
+		}
+		delays = append(delays, d)
+	}
+	for i := 1; i < len(delays); i++ {
+		if d := delays[i] - delays[i-1]; d < 90*time.Millisecond {
+			t.Errorf("slots %d and %d are only %v apart", i-1, i, d)
+		}
+	}
+
+	start := time.Now()
+	if err := client.Acquire(context.Background(), 1); err != nil {
+		t.Fatalf("unable to acquire: %v", err)
+	}
+	if d := time.Since(start); d < delays[2] {
+		t.Errorf("expected to wait at least %v; waited %v", delays[2], d)
+	}
+
+	unknown, _ := throttler.NewDaemonClient("unix", socket, "booking")
+	_, err := unknown.Reserve(context.Background(), 1)
+	checkError(`daemon error: unknown limit "booking"`, err, t)
+}
+
+func TestQueueWithDaemon(t *testing.T) {
+	socket, stop := startDaemon(t, 10)
+	defer stop()
+	var opts []throttler.Option
+	for i := 0; i < 2; i++ {
+		client, _ := throttler.NewDaemonClient("unix", socket, "search")
+		opts = append(opts, throttler.WithDaemon(client))
+	}
+	testSharedLimit(opts, t)
+}
+
+func TestQueueWithDaemonTimeout(t *testing.T) {
+	// the daemon accepts the connections but never answers
+	hang := make(chan struct{})
+	daemon := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-hang
+	}))
+	defer daemon.Close()
+	defer close(hang)
+	client, _ := throttler.NewDaemonClient("tcp", daemon.Listener.Addr().String(), "search")
+	throttler.SetDaemonTimeout(client, 100*time.Millisecond)
+	rate, _ := throttler.NewRateByCallsPerSecond(100, 0)
+	limiter, _ := throttler.New(rate, 5, newMockClient(http.StatusOK), false, throttler.WithDaemon(client))
+	limiter.Run()
+	defer limiter.Close()
+
+	// every request is rejected in time, so the listener does not stall
+	for i := 0; i < 2; i++ {
+		start := time.Now()
+		_, err := queueStatus(limiter)
+		checkError("the daemon did not answer within 100ms", err, t)
+		if d := time.Since(start); d > time.Second {
+			t.Errorf("expected request %d to be rejected after the daemon timeout; waited %v", i, d)
+		}
+	}
+}
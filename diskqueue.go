@@ -0,0 +1,253 @@
+package throttler
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// DiskQueue is an append-only log of the queued requests saved as JSON lines,
+// so the requests pending when the process dies are sent again on restart. Every
+// request is appended when it is queued and marked as completed when Queue
+// returns after sending it, which means that a request may be sent twice if the
+// process dies while it is in flight. The requests which were never sent, because
+// they timed out, were cancelled or the throttler was closed, are left pending
+// and replayed on restart.
+type DiskQueue struct {
+	mu      sync.Mutex
+	path    string
+	f       *os.File
+	nextID  int64
+	pending map[int64]diskEntry
+	replay  []diskEntry
+}
+
+// diskEntry is a line of the log, which either adds a request or marks it as completed
+type diskEntry struct {
+	Op     string      `json:"op"`
+	ID     int64       `json:"id"`
+	Name   string      `json:"name,omitempty"`
+	Method string      `json:"method,omitempty"`
+	URL    string      `json:"url,omitempty"`
+	Header http.Header `json:"header,omitempty"`
+	Body   []byte      `json:"body,omitempty"`
+}
+
+const (
+	diskOpAdd  = "add"
+	diskOpDone = "done"
+)
+
+// diskQueueMode is the mode of the files written by the queue, which hold the
+// headers and bodies of the requests and must only be readable by the owner
+const diskQueueMode = 0600
+
+// NewDiskQueue opens the log at path, creating it if it does not exist, and
+// loads the requests which were not completed. The log is compacted so it only
+// contains those requests.
+func NewDiskQueue(path string) (*DiskQueue, error) {
+	if path == "" {
+		return nil, fmt.Errorf("path can not be empty")
+	}
+	q := &DiskQueue{path: path, pending: make(map[int64]diskEntry)}
+	if err := q.load(); err != nil {
+		return nil, err
+	}
+	if err := q.compact(); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, diskQueueMode)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open the queue file: %v", err)
+	}
+	q.f = f
+	q.replay = q.entries()
+	return q, nil
+}
+
+// Len returns the number of requests which are not completed.
+func (q *DiskQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending)
+}
+
+// Close closes the log file.
+func (q *DiskQueue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.f.Close()
+}
+
+// load reads the log. A broken last line, written while the process died, is ignored.
+func (q *DiskQueue) load() error {
+	f, err := os.Open(q.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to open the queue file: %v", err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 64<<20)
+	var broken error
+	for line := 1; scanner.Scan(); line++ {
+		if broken != nil {
+			return broken
+		}
+		var e diskEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			broken = fmt.Errorf("invalid line %d in the queue file: %v", line, err)
+			continue
+		}
+		switch e.Op {
+		case diskOpAdd:
+			q.pending[e.ID] = e
+		case diskOpDone:
+			delete(q.pending, e.ID)
+		}
+		if e.ID >= q.nextID {
+			q.nextID = e.ID + 1
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("unable to read the queue file: %v", err)
+	}
+	return nil
+}
+
+// compact rewrites the log with the pending requests only
+func (q *DiskQueue) compact() error {
+	var buf bytes.Buffer
+	for _, e := range q.entries() {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(q.path), filepath.Base(q.path))
+	if err != nil {
+		return fmt.Errorf("unable to write the queue file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(diskQueueMode); err != nil {
+		tmp.Close()
+		return fmt.Errorf("unable to write the queue file: %v", err)
+	}
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return fmt.Errorf("unable to write the queue file: %v", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("unable to write the queue file: %v", err)
+	}
+	tmp.Close()
+	if err := os.Rename(tmp.Name(), q.path); err != nil {
+		return fmt.Errorf("unable to write the queue file: %v", err)
+	}
+	return nil
+}
+
+// entries returns the pending requests in the order they were queued
+func (q *DiskQueue) entries() []diskEntry {
+	entries := make([]diskEntry, 0, len(q.pending))
+	for _, e := range q.pending {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID < entries[j].ID })
+	return entries
+}
+
+// add appends the request to the log and returns its id. The body is read and
+// replaced by a copy, so the request can still be sent.
+func (q *DiskQueue) add(name string, hreq *http.Request) (int64, error) {
+	var body []byte
+	if hreq.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(hreq.Body)
+		hreq.Body.Close()
+		if err != nil {
+			return 0, fmt.Errorf("unable to read the request body: %v", err)
+		}
+		hreq.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	e := diskEntry{
+		Op:     diskOpAdd,
+		ID:     q.nextID,
+		Name:   name,
+		Method: hreq.Method,
+		URL:    hreq.URL.String(),
+		Header: hreq.Header,
+		Body:   body,
+	}
+	if err := q.write(e); err != nil {
+		return 0, err
+	}
+	q.nextID++
+	q.pending[e.ID] = e
+	return e.ID, nil
+}
+
+// done marks the request as completed
+func (q *DiskQueue) done(id int64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, ok := q.pending[id]; !ok {
+		return nil
+	}
+	if err := q.write(diskEntry{Op: diskOpDone, ID: id}); err != nil {
+		return err
+	}
+	delete(q.pending, id)
+	return nil
+}
+
+// write appends an entry to the log and flushes it to disk
+func (q *DiskQueue) write(e diskEntry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if _, err := q.f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("unable to write the queue file: %v", err)
+	}
+	if err := q.f.Sync(); err != nil {
+		return fmt.Errorf("unable to write the queue file: %v", err)
+	}
+	return nil
+}
+
+// takeReplay returns the requests left pending by the previous process, only once
+func (q *DiskQueue) takeReplay() []diskEntry {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	entries := q.replay
+	q.replay = nil
+	return entries
+}
+
+// request builds the http.Request saved in the entry
+func (e diskEntry) request() (*http.Request, error) {
+	hreq, err := http.NewRequest(e.Method, e.URL, bytes.NewReader(e.Body))
+	if err != nil {
+		return nil, err
+	}
+	if e.Header != nil {
+		hreq.Header = e.Header
+	}
+	return hreq, nil
+}
@@ -0,0 +1,231 @@
+package throttler_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/centraldereservas/throttler"
+)
+
+func tempQueueFile(t *testing.T, content string) (string, func()) {
+	dir, err := ioutil.TempDir("", "throttler")
+	if err != nil {
+		t.Fatalf("unable to create the temp dir: %v", err)
+	}
+	path := filepath.Join(dir, "queue.jsonl")
+	if content != "" {
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("unable to write the queue file: %v", err)
+		}
+	}
+	return path, func() { os.RemoveAll(dir) }
+}
+
+func TestNewDiskQueue(t *testing.T) {
+	tt := []struct {
+		name    string
+		content string
+		pending int
+		errMsg  string
+	}{
+		{"Positive TC: new file", "", 0, ""},
+		{"Positive TC: pending requests", `{"op":"add","id":0,"name":"a","method":"GET","url":"http://example.com/a"}
+{"op":"add","id":1,"name":"b","method":"GET","url":"http://example.com/b"}
+{"op":"done","id":0}
+`, 1, ""},
+		{"Positive TC: broken last line", `{"op":"add","id":0,"name":"a","method":"GET","url":"http://example.com/a"}
+{"op":"add","id":1,"na`, 1, ""},
+		{"Negative TC: broken line", `{"op":"add","id":0,"na
+{"op":"add","id":1,"name":"b","method":"GET","url":"http://example.com/b"}
+`, 0, "invalid line 1 in the queue file: unexpected end of JSON input"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			path, cleanup := tempQueueFile(t, tc.content)
+			defer cleanup()
+			q, err := throttler.NewDiskQueue(path)
+			checkError(tc.errMsg, err, t)
+			if err != nil {
+				return
+			}
+			defer q.Close()
+			if q.Len() != tc.pending {
+				t.Errorf("expected %d pending requests; got %d", tc.pending, q.Len())
+			}
+			// the file holds the request headers, like Authorization
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatalf("unable to stat the queue file: %v", err)
+			}
+			if runtime.GOOS != "windows" && info.Mode().Perm() != 0600 {
+				t.Errorf("expected the queue file to be only readable by the owner; got %v", info.Mode())
+			}
+		})
+	}
+
+	_, err := throttler.NewDiskQueue("")
+	checkError("path can not be empty", err, t)
+}
+
+func TestQueueWithDiskQueue(t *testing.T) {
+	path, cleanup := tempQueueFile(t, "")
+	defer cleanup()
+	q, _ := throttler.NewDiskQueue(path)
+	var body string
+	client := &http.Client{
+		Transport: &MockTransport{
+			RoundTripMock: func(req *http.Request) (*http.Response, error) {
+				b, _ := ioutil.ReadAll(req.Body)
+				body = string(b)
+				return newMockClient(http.StatusOK).Transport.RoundTrip(req)
+			},
+		},
+	}
+	rate, _ := throttler.NewRateByCallsPerSecond(100, 0)
+	limiter, _ := throttler.New(rate, 5, client, false, throttler.WithDiskQueue(q, duration10s, nil))
+	limiter.Run()
+
+	req, _ := http.NewRequest("POST", "http://example.com/", strings.NewReader(`{"hotel":1}`))
+	res, err := limiter.Queue(context.Background(), "booking", req, duration10s)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	res.Body.Close()
+	if body != `{"hotel":1}` {
+		t.Errorf("expected the body to be sent; got %q", body)
+	}
+	if q.Len() != 0 {
+		t.Errorf("expected the request to be completed; %d pending", q.Len())
+	}
+	q.Close()
+
+	q, _ = throttler.NewDiskQueue(path)
+	defer q.Close()
+	if q.Len() != 0 {
+		t.Errorf("expected the completion to be saved; %d pending", q.Len())
+	}
+}
+
+func TestDiskQueueReplay(t *testing.T) {
+	path, cleanup := tempQueueFile(t, `{"op":"add","id":0,"name":"a","method":"GET","url":"http://example.com/a"}
+{"op":"add","id":1,"name":"b","method":"POST","url":"http://example.com/b","header":{"X-Sync":["1"]},"body":"eyJob3RlbCI6MX0="}
+{"op":"done","id":0}
+`)
+	defer cleanup()
+	q, _ := throttler.NewDiskQueue(path)
+	defer q.Close()
+
+	var sent *http.Request
+	var body string
+	client := &http.Client{
+		Transport: &MockTransport{
+			RoundTripMock: func(req *http.Request) (*http.Response, error) {
+				b, _ := ioutil.ReadAll(req.Body)
+				sent, body = req, string(b)
+				return newMockClient(http.StatusOK).Transport.RoundTrip(req)
+			},
+		},
+	}
+	var mu sync.Mutex
+	var replayed []string
+	done := make(chan struct{})
+	replay := func(name string, res *http.Response, err error) {
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		} else {
+			res.Body.Close()
+		}
+		mu.Lock()
+		replayed = append(replayed, name)
+		mu.Unlock()
+		close(done)
+	}
+	rate, _ := throttler.NewRateByCallsPerSecond(100, 0)
+	limiter, _ := throttler.New(rate, 5, client, false, throttler.WithDiskQueue(q, duration10s, replay))
+	limiter.Run()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("the pending request was not replayed")
+	}
+	if len(replayed) != 1 || replayed[0] != "b" {
+		t.Errorf("expected request b to be replayed; got %v", replayed)
+	}
+	if sent.Method != "POST" || sent.URL.String() != "http://example.com/b" || sent.Header.Get("X-Sync") != "1" || body != `{"hotel":1}` {
+		t.Errorf("unexpected request sent: %v %v %v %q", sent.Method, sent.URL, sent.Header, body)
+	}
+	if q.Len() != 0 {
+		t.Errorf("expected the replayed request to be completed; %d pending", q.Len())
+	}
+}
+
+func TestDiskQueueNotSent(t *testing.T) {
+	tt := []struct {
+		name   string
+		end    func(limiter throttler.Limiter)
+		errMsg string
+	}{
+		{"Positive TC: closed", func(limiter throttler.Limiter) { limiter.Close() }, "throttler is closed"},
+		{"Positive TC: cancelled", func(limiter throttler.Limiter) { limiter.CancelByName("booking") }, "request cancelled"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			path, cleanup := tempQueueFile(t, "")
+			defer cleanup()
+			q, _ := throttler.NewDiskQueue(path)
+			rate, _ := throttler.NewRateByCallsPerSecond(100, 0)
+			limiter, _ := throttler.New(rate, 5, newMockClient(http.StatusOK), false, throttler.WithDiskQueue(q, duration10s, nil))
+			limiter.Run()
+			limiter.Pause()
+			errs := queuePaused(limiter, "booking")
+			tc.end(limiter)
+			checkError(tc.errMsg, <-errs[0], t)
+			limiter.Close()
+			if q.Len() != 1 {
+				t.Errorf("expected the request not sent to be pending; %d pending", q.Len())
+			}
+			q.Close()
+
+			// the request is replayed by the next process
+			q, _ = throttler.NewDiskQueue(path)
+			defer q.Close()
+			if q.Len() != 1 {
+				t.Fatalf("expected the request not sent to be saved as pending; %d pending", q.Len())
+			}
+			done := make(chan string, 1)
+			replay := func(name string, res *http.Response, err error) {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				} else {
+					res.Body.Close()
+				}
+				done <- name
+			}
+			limiter, _ = throttler.New(rate, 5, newMockClient(http.StatusOK), false, throttler.WithDiskQueue(q, duration10s, replay))
+			limiter.Run()
+			defer limiter.Close()
+			select {
+			case name := <-done:
+				if name != "booking" {
+					t.Errorf("expected request booking to be replayed; got %v", name)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("the request not sent was not replayed")
+			}
+			if q.Len() != 0 {
+				t.Errorf("expected the replayed request to be completed; %d pending", q.Len())
+			}
+		})
+	}
+}
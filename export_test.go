@@ -1,6 +1,42 @@
 package throttler
 
+import (
+	"net/http"
+	"time"
+)
+
 // Export for testing.
 var NewListener = newListener
 var NewClientHandler = newClientHandler
 var NewFulfiller = newFulfiller
+
+// SetScheduleClock replaces the clock of a Rate built with NewScheduledRate.
+func SetScheduleClock(r Rate, now func() time.Time) {
+	r.(*scheduledRate).now = now
+}
+
+// NextScheduleChange returns the next change of a Rate built with NewScheduledRate.
+func NextScheduleChange(r Rate) time.Time {
+	return r.(*scheduledRate).nextChange()
+}
+
+// SetAdaptiveClock replaces the clock of an AdaptiveRate.
+func SetAdaptiveClock(a *AdaptiveRate, now func() time.Time) {
+	a.now = now
+}
+
+// ObserveAdaptive reports to an AdaptiveRate, or a Rate built with NewScheduledRate,
+// the response of a request sent at the given time.
+func ObserveAdaptive(r Rate, sent time.Time, status int, err error) {
+	res := &Response{Err: err}
+	if err == nil {
+		res.HRes = &http.Response{StatusCode: status}
+	}
+	r.(adaptiveRate).observe(sent, res)
+}
+
+// SetDaemonTimeout replaces the time that the throttlers created WithDaemon wait
+// for the daemon.
+func SetDaemonTimeout(c *DaemonClient, timeout time.Duration) {
+	c.timeout = timeout
+}
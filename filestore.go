@@ -0,0 +1,134 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package throttler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// FileStore is a Store kept in a local file protected by flock, so that the
+// throttlers of several processes running in the same host share the rate
+// without a network server.
+type FileStore struct {
+	mu   sync.Mutex
+	path string
+	now  func() time.Time
+}
+
+type fileValue struct {
+	Value   string    `json:"value"`
+	Expires time.Time `json:"expires"`
+}
+
+// NewFileStore initializes a FileStore saved in the file at path, which is
+// created if it does not exist.
+func NewFileStore(path string) (*FileStore, error) {
+	if path == "" {
+		return nil, fmt.Errorf("path can not be empty")
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open the store file: %v", err)
+	}
+	f.Close()
+	return &FileStore{path: path, now: time.Now}, nil
+}
+
+// Get returns the value stored at key, or an empty string if it does not exist.
+func (s *FileStore) Get(key string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := s.lock(syscall.LOCK_SH)
+	if err != nil {
+		return "", err
+	}
+	defer s.unlock(f)
+	values, err := s.read(f)
+	if err != nil {
+		return "", err
+	}
+	return values[key].Value, nil
+}
+
+// CompareAndSwap stores value at key only if it still holds old.
+func (s *FileStore) CompareAndSwap(key string, old string, value string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := s.lock(syscall.LOCK_EX)
+	if err != nil {
+		return false, err
+	}
+	defer s.unlock(f)
+	values, err := s.read(f)
+	if err != nil {
+		return false, err
+	}
+	if values[key].Value != old {
+		return false, nil
+	}
+	values[key] = fileValue{Value: value, Expires: s.now().Add(ttl)}
+	return true, s.write(f, values)
+}
+
+// lock opens the file and locks it with the given flock operation
+func (s *FileStore) lock(how int) (*os.File, error) {
+	f, err := os.OpenFile(s.path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open the store file: %v", err)
+	}
+	if err := syscall.Flock(int(f.Fd()), how); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("unable to lock the store file: %v", err)
+	}
+	return f, nil
+}
+
+func (s *FileStore) unlock(f *os.File) {
+	syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+	f.Close()
+}
+
+// read returns the values of the file which have not expired
+func (s *FileStore) read(f *os.File) (map[string]fileValue, error) {
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the store file: %v", err)
+	}
+	values := make(map[string]fileValue)
+	if len(data) == 0 {
+		return values, nil
+	}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("unable to parse the store file: %v", err)
+	}
+	now := s.now()
+	for key, v := range values {
+		if !now.Before(v.Expires) {
+			delete(values, key)
+		}
+	}
+	return values, nil
+}
+
+// write replaces the content of the file, which is rewritten in place because
+// the lock belongs to the file
+func (s *FileStore) write(f *os.File, values map[string]fileValue) error {
+	data, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+	if err := f.Truncate(0); err != nil {
+		return fmt.Errorf("unable to write the store file: %v", err)
+	}
+	if _, err := f.WriteAt(data, 0); err != nil {
+		return fmt.Errorf("unable to write the store file: %v", err)
+	}
+	return f.Sync()
+}
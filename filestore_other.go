@@ -0,0 +1,28 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package throttler
+
+import (
+	"fmt"
+	"time"
+)
+
+// FileStore is a Store kept in a local file protected by flock, which is not
+// available on this platform.
+type FileStore struct{}
+
+// NewFileStore returns an error because flock is not available on this platform.
+func NewFileStore(path string) (*FileStore, error) {
+	return nil, fmt.Errorf("file store is not supported on this platform")
+}
+
+// Get is not supported on this platform.
+func (s *FileStore) Get(key string) (string, error) {
+	return "", fmt.Errorf("file store is not supported on this platform")
+}
+
+// CompareAndSwap is not supported on this platform.
+func (s *FileStore) CompareAndSwap(key string, old string, value string, ttl time.Duration) (bool, error) {
+	return false, fmt.Errorf("file store is not supported on this platform")
+}
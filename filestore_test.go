@@ -0,0 +1,70 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package throttler_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/centraldereservas/throttler"
+)
+
+func TestNewFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "throttler")
+	if err != nil {
+		t.Fatalf("unable to create the temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	tt := []struct {
+		name   string
+		path   string
+		errMsg string
+	}{
+		{"Positive TC", filepath.Join(dir, "store.json"), ""},
+		{"Negative TC: path empty", "", "path can not be empty"},
+		{"Negative TC: missing dir", filepath.Join(dir, "missing", "store.json"), "unable to open the store file: open " + filepath.Join(dir, "missing", "store.json") + ": no such file or directory"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := throttler.NewFileStore(tc.path)
+			checkError(tc.errMsg, err, t)
+		})
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "throttler")
+	if err != nil {
+		t.Fatalf("unable to create the temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := throttler.NewFileStore(filepath.Join(dir, "store.json"))
+	if err != nil {
+		t.Fatalf("unable to create the store: %v", err)
+	}
+	testStore(store, t)
+}
+
+// TestQueueWithFileStore uses a FileStore per throttler, as two processes would do
+func TestQueueWithFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "throttler")
+	if err != nil {
+		t.Fatalf("unable to create the temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "store.json")
+	var stores []throttler.Store
+	for i := 0; i < 2; i++ {
+		store, err := throttler.NewFileStore(path)
+		if err != nil {
+			t.Fatalf("unable to create the store: %v", err)
+		}
+		stores = append(stores, store)
+	}
+	testSharedStores(stores, t)
+}
@@ -33,3 +33,12 @@ func (f *fulfillHandler) fulfill(req *Request) {
 		req.ResChan <- res // context is alive, submit response
 	}
 }
+
+// reject copies a response with the given error into the channel specified in
+// the request, unless its context is already cancelled
+func reject(req *Request, err error) {
+	select {
+	case <-req.Ctx.Done():
+	case req.ResChan <- &Response{Err: err}:
+	}
+}
@@ -0,0 +1,188 @@
+package throttler
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// gcraPurgeInterval is the number of operations between two purges of the
+// expired keys of a GCRALimiter
+const gcraPurgeInterval = 1024
+
+// emission returns the emission interval of the generic cell rate algorithm,
+// rounded up so the limit is never exceeded
+func (lim limit) emission() time.Duration {
+	return lim.span(1)
+}
+
+// span returns the emission interval of cost cells, rounded up as a whole so the
+// rounding error does not grow with the cost
+func (lim limit) span(cost int64) time.Duration {
+	tr := int64(lim.timeReference)
+	q, r := tr/lim.calls, tr%lim.calls
+	return time.Duration(cost*q+(cost*r+lim.calls-1)/lim.calls) + time.Duration(cost)*lim.guardTime
+}
+
+// gcraNext returns the first time at or after now when cost cells conform,
+// given the theoretical arrival time tat of the next cell. A cost bigger than
+// the burst waits until the bucket is empty.
+func gcraNext(tat time.Time, now time.Time, lim limit, burst int64, cost int64) time.Time {
+	if cost > burst {
+		cost = burst
+	}
+	allowAt := tat.Add(-lim.span(burst - cost))
+	if allowAt.After(now) {
+		return allowAt
+	}
+	return now
+}
+
+// gcraCommit returns the theoretical arrival time after cost cells sent at the given time
+func gcraCommit(tat time.Time, at time.Time, lim limit, cost int64) time.Time {
+	if at.After(tat) {
+		tat = at
+	}
+	return tat.Add(lim.span(cost))
+}
+
+// gcraScheduler schedules the requests with the generic cell rate algorithm,
+// which allows bursts of up to burst requests and keeps one timestamp as state
+type gcraScheduler struct {
+	tat   time.Time
+	burst int64
+}
+
+func (g *gcraScheduler) next(now time.Time, lim limit, cost int64) time.Time {
+	return gcraNext(g.tat, now, lim, g.burst, cost)
+}
+
+func (g *gcraScheduler) commit(at time.Time, lim limit, cost int64) {
+	g.tat = gcraCommit(g.tat, at, lim, cost)
+}
+
+// release moves the theoretical arrival time back if the slot is the last one
+func (g *gcraScheduler) release(at time.Time, lim limit, cost int64) {
+	d := lim.span(cost)
+	if !g.tat.After(at.Add(d)) {
+		g.tat = g.tat.Add(-d)
+	}
+}
+
+// GCRALimiter is a keyed rate limiter based on the generic cell rate algorithm. It keeps
+// a single timestamp per key, so it is suited to limit a large number of keys
+// (for instance one per customer) without the listener.
+type GCRALimiter struct {
+	mu    sync.Mutex
+	rate  Rate
+	burst int64
+	tats  map[string]time.Time
+	ops   int
+	now   func() time.Time
+}
+
+// NewGCRALimiter initializes a GCRALimiter that allows, for every key, the calls of the
+// rate evenly spaced plus bursts of up to burst calls.
+func NewGCRALimiter(rate Rate, burst int) (*GCRALimiter, error) {
+	if rate == nil {
+		return nil, fmt.Errorf("rate can not be nil")
+	}
+	if burst <= 0 {
+		return nil, fmt.Errorf("burst must be greater than zero")
+	}
+	return &GCRALimiter{
+		rate:  rate,
+		burst: int64(burst),
+		tats:  make(map[string]time.Time),
+		now:   time.Now,
+	}, nil
+}
+
+// Allow reports whether a call for key conforms now, and records it if it does.
+func (g *GCRALimiter) Allow(key string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := g.now()
+	lim := limitOf(g.rate)
+	tat := g.tats[key]
+	if gcraNext(tat, now, lim, g.burst, 1).After(now) {
+		return false
+	}
+	g.record(key, gcraCommit(tat, now, lim, 1), now)
+	return true
+}
+
+// Reserve records a call for key and returns how long the caller must wait
+// before sending it.
+func (g *GCRALimiter) Reserve(key string) time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := g.now()
+	lim := limitOf(g.rate)
+	tat := g.tats[key]
+	at := gcraNext(tat, now, lim, g.burst, 1)
+	g.record(key, gcraCommit(tat, at, lim, 1), now)
+	return at.Sub(now)
+}
+
+// record stores the theoretical arrival time of the key and from time to time
+// removes the keys that are back to their initial state
+func (g *GCRALimiter) record(key string, tat time.Time, now time.Time) {
+	g.tats[key] = tat
+	g.ops++
+	if g.ops < gcraPurgeInterval {
+		return
+	}
+	g.ops = 0
+	for k, t := range g.tats {
+		if !t.After(now) {
+			delete(g.tats, k)
+		}
+	}
+}
+
+// release gives back the call reserved for key by reserveWithin, which left the
+// given theoretical arrival time, if no call was recorded after it
+func (g *GCRALimiter) release(key string, reserved time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if tat, ok := g.tats[key]; ok && tat.Equal(reserved) {
+		g.tats[key] = tat.Add(-limitOf(g.rate).span(1))
+	}
+}
+
+// gcraResult is the outcome of GCRALimiter.reserveWithin
+type gcraResult struct {
+	tat       time.Time
+	delay     time.Duration
+	ok        bool
+	remaining int64
+	reset     time.Duration
+}
+
+// reserveWithin records a call for key only if the caller would wait at most
+// maxWait for it. It also returns the calls that could still be sent at once
+// and the time until the key is back to its initial state.
+func (g *GCRALimiter) reserveWithin(key string, maxWait time.Duration) gcraResult {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := g.now()
+	lim := limitOf(g.rate)
+	tat := g.tats[key]
+	at := gcraNext(tat, now, lim, g.burst, 1)
+	r := gcraResult{delay: at.Sub(now)}
+	if r.delay <= maxWait {
+		r.ok = true
+		tat = gcraCommit(tat, at, lim, 1)
+		g.record(key, tat, now)
+		r.tat = tat
+	}
+	if tat.After(now) {
+		r.reset = tat.Sub(now)
+	}
+	r.remaining = g.burst - int64((r.reset+lim.emission()-1)/lim.emission())
+	if r.remaining < 0 {
+		r.remaining = 0
+	}
+	return r
+}
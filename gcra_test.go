@@ -0,0 +1,116 @@
+package throttler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewGCRALimiter(t *testing.T) {
+	tt := []struct {
+		name    string
+		rateNil bool
+		burst   int
+		errMsg  string
+	}{
+		{"Positive TC", false, 3, ""},
+		{"Negative TC: rate nil", true, 3, "rate can not be nil"},
+		{"Negative TC: burst zero", false, 0, "burst must be greater than zero"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var r Rate
+			if !tc.rateNil {
+				r, _ = NewRateByCallsPerSecond(10, 0)
+			}
+			g, err := NewGCRALimiter(r, tc.burst)
+			if !checkError(tc.errMsg, err, t) && g == nil {
+				t.Errorf("expected a limiter")
+			}
+		})
+	}
+}
+
+func TestGCRALimiterAllow(t *testing.T) {
+	r, _ := NewRateByCallsPerSecond(10, 0)
+	g, err := NewGCRALimiter(r, 3)
+	if err != nil {
+		t.Fatalf("unable to create a limiter: %v", err)
+	}
+	now := time.Unix(1000, 0)
+	g.now = func() time.Time { return now }
+
+	tt := []struct {
+		name     string
+		key      string
+		elapsed  time.Duration
+		expected bool
+	}{
+		{"Positive TC: first call", "a", 0, true},
+		{"Positive TC: second call of the burst", "a", 0, true},
+		{"Positive TC: third call of the burst", "a", 0, true},
+		{"Negative TC: burst exhausted", "a", 0, false},
+		{"Positive TC: another key", "b", 0, true},
+		{"Negative TC: before the emission interval", "a", 99 * time.Millisecond, false},
+		{"Positive TC: after the emission interval", "a", time.Millisecond, true},
+		{"Negative TC: the next call waits again", "a", 0, false},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			now = now.Add(tc.elapsed)
+			if allowed := g.Allow(tc.key); allowed != tc.expected {
+				t.Errorf("expected allowed %v; got %v", tc.expected, allowed)
+			}
+		})
+	}
+}
+
+func TestGCRALimiterReserve(t *testing.T) {
+	r, _ := NewRateByCallsPerSecond(10, 0)
+	g, err := NewGCRALimiter(r, 2)
+	if err != nil {
+		t.Fatalf("unable to create a limiter: %v", err)
+	}
+	now := time.Unix(1000, 0)
+	g.now = func() time.Time { return now }
+
+	expected := []time.Duration{0, 0, 100 * time.Millisecond, 200 * time.Millisecond}
+	for i, delay := range expected {
+		if d := g.Reserve("a"); d != delay {
+			t.Errorf("reservation %d: expected delay %v; got %v", i, delay, d)
+		}
+	}
+
+	// the keys whose state expired are purged
+	now = now.Add(time.Minute)
+	for i := 0; i < gcraPurgeInterval; i++ {
+		g.Allow("b")
+		now = now.Add(time.Second)
+	}
+	if _, ok := g.tats["a"]; ok {
+		t.Errorf("expected key a to be purged")
+	}
+}
+
+func TestLimitSpan(t *testing.T) {
+	tt := []struct {
+		name     string
+		lim      limit
+		cost     int64
+		expected time.Duration
+	}{
+		{"Positive TC: one call", limit{timeReference: time.Second, calls: 3}, 1, 333333334},
+		{"Positive TC: rounded as a whole", limit{timeReference: time.Second, calls: 3}, 3, time.Second},
+		{"Positive TC: guard time per call", limit{timeReference: time.Second, calls: 10, guardTime: time.Millisecond}, 2, 202 * time.Millisecond},
+		{"Positive TC: many calls", limit{timeReference: time.Second, calls: 300000000}, 30000000, 100 * time.Millisecond},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			if d := tc.lim.span(tc.cost); d != tc.expected {
+				t.Errorf("expected %v; got %v", tc.expected, d)
+			}
+		})
+	}
+}
@@ -0,0 +1,10 @@
+// Package grpcthrottle provides gRPC client and server interceptors which
+// acquire slots from throttler limiters before every call, using the same
+// schedule as Limiter.Queue.
+//
+// The interceptors depend on google.golang.org/grpc, so they are only built
+// with the grpc build tag, which keeps the throttler free of dependencies:
+//
+//	go get google.golang.org/grpc
+//	go build -tags grpc
+package grpcthrottle
@@ -0,0 +1,244 @@
+//go:build grpc
+// +build grpc
+
+package grpcthrottle
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/centraldereservas/throttler"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Option configures optional features of the Interceptors created by New.
+type Option func(*Interceptors) error
+
+// WithCost sets the function which returns the number of units of the rate
+// consumed by a call of the full method name (e.g. "/booking.Booking/Confirm").
+// Calls of cost zero are not throttled. By default every call costs one unit.
+func WithCost(cost func(method string) int) Option {
+	return func(i *Interceptors) error {
+		if cost == nil {
+			return fmt.Errorf("cost can not be nil")
+		}
+		i.cost = cost
+		return nil
+	}
+}
+
+// WithKey sets the function which returns the key of the limiter of a call,
+// for instance the client identity taken from the metadata of the context.
+// By default all the calls share the limiter of the empty key.
+func WithKey(key func(ctx context.Context, method string) string) Option {
+	return func(i *Interceptors) error {
+		if key == nil {
+			return fmt.Errorf("key can not be nil")
+		}
+		i.key = key
+		return nil
+	}
+}
+
+// WithMaxKeys sets the number of limiters kept, 1000 by default. When the limiter
+// of a new key is created, the least recently used one without calls waiting for
+// a slot is closed, so the clients can not make the interceptors grow without
+// bound with the keys they choose.
+func WithMaxKeys(maxKeys int) Option {
+	return func(i *Interceptors) error {
+		if maxKeys <= 0 {
+			return fmt.Errorf("maxKeys must be greater than zero")
+		}
+		i.maxKeys = maxKeys
+		return nil
+	}
+}
+
+// Interceptors throttles gRPC calls with a throttler.Limiter per key.
+type Interceptors struct {
+	mu         sync.Mutex
+	limiters   map[string]*list.Element
+	recent     *list.List
+	maxKeys    int
+	limiterFor func(key string) (throttler.Limiter, error)
+	cost       func(method string) int
+	key        func(ctx context.Context, method string) string
+}
+
+// keyLimiter is the limiter of a key, kept in the list of the recently used ones
+type keyLimiter struct {
+	key     string
+	limiter throttler.Limiter
+	active  int
+}
+
+// New initializes the interceptors, which create the limiter of every key with
+// limiterFor on its first call.
+func New(limiterFor func(key string) (throttler.Limiter, error), opts ...Option) (*Interceptors, error) {
+	if limiterFor == nil {
+		return nil, fmt.Errorf("limiterFor can not be nil")
+	}
+	i := &Interceptors{
+		limiters:   make(map[string]*list.Element),
+		recent:     list.New(),
+		maxKeys:    1000,
+		limiterFor: limiterFor,
+		cost:       func(string) int { return 1 },
+		key:        func(context.Context, string) string { return "" },
+	}
+	for _, opt := range opts {
+		if err := opt(i); err != nil {
+			return nil, err
+		}
+	}
+	return i, nil
+}
+
+// UnaryClient returns a client interceptor which waits for a slot before every unary call.
+func (i *Interceptors) UnaryClient() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if err := i.acquire(ctx, method); err != nil {
+			return err
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClient returns a client interceptor which waits for a slot before opening every stream.
+func (i *Interceptors) StreamClient() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		if err := i.acquire(ctx, method); err != nil {
+			return nil, err
+		}
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
+
+// UnaryServer returns a server interceptor which waits for a slot before handling every unary call.
+func (i *Interceptors) UnaryServer() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := i.acquire(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServer returns a server interceptor which waits for a slot before handling every stream.
+func (i *Interceptors) StreamServer() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := i.acquire(ss.Context(), info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+// acquire reserves a slot for the call and waits until it is granted. A slot
+// after the deadline of the context, or a reservation rejected by the quota or
+// the breaker of the limiter, fails at once with ResourceExhausted. A negative
+// cost fails with InvalidArgument, and the rest of errors, like a closed
+// limiter, with Internal.
+func (i *Interceptors) acquire(ctx context.Context, method string) error {
+	cost := i.cost(method)
+	if cost == 0 {
+		return nil
+	}
+	if cost < 0 {
+		return status.Errorf(codes.InvalidArgument, "cost of %v can not be negative", method)
+	}
+	l, release, err := i.limiter(i.key(ctx, method))
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	defer release()
+	r, err := l.Reserve(ctx, cost)
+	if err != nil {
+		return reserveStatus(ctx, err)
+	}
+	if err := r.Commit(); err != nil {
+		return status.FromContextError(err).Err()
+	}
+	return nil
+}
+
+// reserveStatus returns the status of a call whose reservation failed
+func reserveStatus(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return status.FromContextError(ctx.Err()).Err()
+	}
+	switch err {
+	case throttler.ErrQuotaExhausted, throttler.ErrBreakerOpen, throttler.ErrReservationDeadline:
+		return status.Error(codes.ResourceExhausted, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+// limiter returns the limiter of the key, creating it on its first call, and the
+// function to call once the call has its slot. When there are more than maxKeys
+// limiters the least recently used idle ones are removed and closed.
+func (i *Interceptors) limiter(key string) (throttler.Limiter, func(), error) {
+	i.mu.Lock()
+	e, ok := i.limiters[key]
+	if ok {
+		i.recent.MoveToFront(e)
+	} else {
+		l, err := i.limiterFor(key)
+		if err != nil {
+			i.mu.Unlock()
+			return nil, nil, fmt.Errorf("unable to create the limiter of %q: %v", key, err)
+		}
+		if l == nil {
+			i.mu.Unlock()
+			return nil, nil, fmt.Errorf("unable to create the limiter of %q: limiter can not be nil", key)
+		}
+		e = i.recent.PushFront(&keyLimiter{key: key, limiter: l})
+		i.limiters[key] = e
+	}
+	kl := e.Value.(*keyLimiter)
+	kl.active++
+	evicted := i.evict()
+	i.mu.Unlock()
+
+	closeLimiters(evicted)
+	return kl.limiter, func() { i.release(kl) }, nil
+}
+
+// release marks the end of a call waiting for a slot of the limiter, which can be
+// evicted once it has no more calls
+func (i *Interceptors) release(kl *keyLimiter) {
+	i.mu.Lock()
+	kl.active--
+	evicted := i.evict()
+	i.mu.Unlock()
+
+	closeLimiters(evicted)
+}
+
+// evict removes the least recently used limiters without calls while there are
+// more than maxKeys, and returns them to be closed
+func (i *Interceptors) evict() []throttler.Limiter {
+	var evicted []throttler.Limiter
+	for e := i.recent.Back(); e != nil && i.recent.Len() > i.maxKeys; {
+		prev := e.Prev()
+		if kl := e.Value.(*keyLimiter); kl.active == 0 {
+			i.recent.Remove(e)
+			delete(i.limiters, kl.key)
+			evicted = append(evicted, kl.limiter)
+		}
+		e = prev
+	}
+	return evicted
+}
+
+// closeLimiters closes the evicted limiters
+func closeLimiters(limiters []throttler.Limiter) {
+	for _, l := range limiters {
+		l.Close()
+	}
+}
@@ -0,0 +1,298 @@
+//go:build grpc
+// +build grpc
+
+package grpcthrottle_test
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/centraldereservas/throttler"
+	"github.com/centraldereservas/throttler/grpcthrottle"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func checkError(expected string, err error, t *testing.T) {
+	got := ""
+	if err != nil {
+		got = err.Error()
+	}
+	if got != expected {
+		t.Errorf("expected error %q; got %q", expected, got)
+	}
+}
+
+// limiterFor creates limiters whose first call is not delayed
+func limiterFor(key string) (throttler.Limiter, error) {
+	rate, _ := throttler.NewRateByCallsPerSecond(10, 0)
+	return throttler.New(rate, 0, nil, false, throttler.WithStrategy(throttler.GCRA))
+}
+
+func TestNew(t *testing.T) {
+	tt := []struct {
+		name       string
+		limiterFor func(key string) (throttler.Limiter, error)
+		opts       []grpcthrottle.Option
+		errMsg     string
+	}{
+		{"Positive TC", limiterFor, nil, ""},
+		{"Negative TC: limiterFor nil", nil, nil, "limiterFor can not be nil"},
+		{"Negative TC: cost nil", limiterFor, []grpcthrottle.Option{grpcthrottle.WithCost(nil)}, "cost can not be nil"},
+		{"Negative TC: key nil", limiterFor, []grpcthrottle.Option{grpcthrottle.WithKey(nil)}, "key can not be nil"},
+		{"Negative TC: max keys zero", limiterFor, []grpcthrottle.Option{grpcthrottle.WithMaxKeys(0)}, "maxKeys must be greater than zero"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := grpcthrottle.New(tc.limiterFor, tc.opts...)
+			checkError(tc.errMsg, err, t)
+		})
+	}
+}
+
+// dial starts an in-process server of the health service and returns a client
+func dial(t *testing.T, server []grpc.ServerOption, client []grpc.DialOption) (healthpb.HealthClient, func()) {
+	ln := bufconn.Listen(1 << 20)
+	s := grpc.NewServer(server...)
+	healthpb.RegisterHealthServer(s, health.NewServer())
+	go s.Serve(ln)
+	dialer := func(ctx context.Context, _ string) (net.Conn, error) {
+		return ln.DialContext(ctx)
+	}
+	opts := append([]grpc.DialOption{
+		grpc.WithContextDialer(dialer),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	}, client...)
+	conn, err := grpc.NewClient("passthrough:///bufnet", opts...)
+	if err != nil {
+		t.Fatalf("unable to dial: %v", err)
+	}
+	return healthpb.NewHealthClient(conn), func() {
+		conn.Close()
+		s.Stop()
+	}
+}
+
+// checkCalls makes n calls and returns how long they took
+func checkCalls(ctx context.Context, c healthpb.HealthClient, n int, t *testing.T) time.Duration {
+	start := time.Now()
+	for i := 0; i < n; i++ {
+		if _, err := c.Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	return time.Since(start)
+}
+
+func TestUnaryClient(t *testing.T) {
+	i, _ := grpcthrottle.New(limiterFor)
+	c, stop := dial(t, nil, []grpc.DialOption{grpc.WithUnaryInterceptor(i.UnaryClient())})
+	defer stop()
+
+	// 3 calls at 10 calls per second take at least 200ms
+	if d := checkCalls(context.Background(), c, 3, t); d < 190*time.Millisecond {
+		t.Errorf("expected the calls to be throttled; took %v", d)
+	}
+}
+
+// apiKey returns the x-api-key of the metadata of the call
+func apiKey(ctx context.Context, method string) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if v := md.Get("x-api-key"); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+func TestUnaryServerKey(t *testing.T) {
+	i, _ := grpcthrottle.New(limiterFor, grpcthrottle.WithKey(apiKey))
+	c, stop := dial(t, []grpc.ServerOption{grpc.UnaryInterceptor(i.UnaryServer())}, nil)
+	defer stop()
+
+	// every key has its own limiter, so the first call of each one is not delayed
+	a := metadata.AppendToOutgoingContext(context.Background(), "x-api-key", "a")
+	b := metadata.AppendToOutgoingContext(context.Background(), "x-api-key", "b")
+	checkCalls(a, c, 1, t)
+	if d := checkCalls(b, c, 1, t); d > 50*time.Millisecond {
+		t.Errorf("expected key b not to be throttled by key a; took %v", d)
+	}
+	if d := checkCalls(a, c, 2, t); d < 190*time.Millisecond {
+		t.Errorf("expected the calls of key a to be throttled; took %v", d)
+	}
+}
+
+func TestMaxKeys(t *testing.T) {
+	var mu sync.Mutex
+	limiters := make(map[string][]throttler.Limiter)
+	limiterFor := func(key string) (throttler.Limiter, error) {
+		l, err := limiterFor(key)
+		mu.Lock()
+		limiters[key] = append(limiters[key], l)
+		mu.Unlock()
+		return l, err
+	}
+	created := func(key string) []throttler.Limiter {
+		mu.Lock()
+		defer mu.Unlock()
+		return limiters[key]
+	}
+	i, _ := grpcthrottle.New(limiterFor, grpcthrottle.WithKey(apiKey), grpcthrottle.WithMaxKeys(1))
+	c, stop := dial(t, []grpc.ServerOption{grpc.UnaryInterceptor(i.UnaryServer())}, nil)
+	defer stop()
+	a := metadata.AppendToOutgoingContext(context.Background(), "x-api-key", "a")
+	b := metadata.AppendToOutgoingContext(context.Background(), "x-api-key", "b")
+
+	// b evicts a, which is closed and created again on its next call
+	checkCalls(a, c, 1, t)
+	checkCalls(b, c, 1, t)
+	checkCalls(a, c, 1, t)
+	if len(created("a")) != 2 || len(created("b")) != 1 {
+		t.Fatalf("expected 2 limiters of a and 1 of b; got %v and %v", len(created("a")), len(created("b")))
+	}
+	if _, err := created("a")[0].Reserve(context.Background(), 1); err != throttler.ErrClosed {
+		t.Errorf("expected the evicted limiter to be closed; got %v", err)
+	}
+
+	// a call waiting for its slot keeps the limiter of a, so b is evicted instead
+	// once its call is done
+	waiting := make(chan error, 1)
+	go func() {
+		_, err := c.Check(a, &healthpb.HealthCheckRequest{})
+		waiting <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	checkCalls(b, c, 1, t)
+	if err := <-waiting; err != nil {
+		t.Errorf("unexpected error of the waiting call: %v", err)
+	}
+	if len(created("a")) != 2 {
+		t.Errorf("expected the limiter of a not to be evicted while waiting; got %v limiters", len(created("a")))
+	}
+	if b := created("b"); len(b) != 2 {
+		t.Errorf("expected 2 limiters of b; got %v", len(b))
+	} else if _, err := b[1].Reserve(context.Background(), 1); err != throttler.ErrClosed {
+		t.Errorf("expected the idle limiter of b to be closed; got %v", err)
+	}
+}
+
+func TestUnaryServerDeadline(t *testing.T) {
+	i, _ := grpcthrottle.New(limiterFor)
+	c, stop := dial(t, []grpc.ServerOption{grpc.UnaryInterceptor(i.UnaryServer())}, nil)
+	defer stop()
+	checkCalls(context.Background(), c, 1, t)
+
+	// the next slot is 100ms later, after the deadline
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := c.Check(ctx, &healthpb.HealthCheckRequest{})
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("expected code %v; got %v", codes.ResourceExhausted, err)
+	}
+}
+
+func TestCost(t *testing.T) {
+	cost := func(method string) int {
+		if method == "/grpc.health.v1.Health/Check" {
+			return 0
+		}
+		return 1
+	}
+	i, _ := grpcthrottle.New(limiterFor, grpcthrottle.WithCost(cost))
+	c, stop := dial(t, []grpc.ServerOption{grpc.UnaryInterceptor(i.UnaryServer())}, nil)
+	defer stop()
+	if d := checkCalls(context.Background(), c, 3, t); d > 50*time.Millisecond {
+		t.Errorf("expected the free calls not to be throttled; took %v", d)
+	}
+}
+
+func TestStatusCode(t *testing.T) {
+	closed := func(key string) (throttler.Limiter, error) {
+		l, err := limiterFor(key)
+		if err == nil {
+			l.Close()
+		}
+		return l, err
+	}
+	tt := []struct {
+		name       string
+		limiterFor func(key string) (throttler.Limiter, error)
+		cost       int
+		code       codes.Code
+		msg        string
+	}{
+		{"Positive TC", limiterFor, 1, codes.OK, ""},
+		{"Negative TC: negative cost", limiterFor, -1, codes.InvalidArgument, "cost of /grpc.health.v1.Health/Check can not be negative"},
+		{"Negative TC: closed limiter", closed, 1, codes.Internal, throttler.ErrClosed.Error()},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			cost := func(string) int { return tc.cost }
+			i, _ := grpcthrottle.New(tc.limiterFor, grpcthrottle.WithCost(cost))
+			c, stop := dial(t, []grpc.ServerOption{grpc.UnaryInterceptor(i.UnaryServer())}, nil)
+			defer stop()
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			_, err := c.Check(ctx, &healthpb.HealthCheckRequest{})
+			if status.Code(err) != tc.code || status.Convert(err).Message() != tc.msg {
+				t.Errorf("expected code %v with message %q; got %v", tc.code, tc.msg, err)
+			}
+		})
+	}
+}
+
+func TestStream(t *testing.T) {
+	i, _ := grpcthrottle.New(limiterFor)
+	c, stop := dial(t,
+		[]grpc.ServerOption{grpc.StreamInterceptor(i.StreamServer())},
+		[]grpc.DialOption{grpc.WithStreamInterceptor(i.StreamClient())})
+	defer stop()
+
+	// the client and the server share the limiter, so every stream takes two slots
+	start := time.Now()
+	for n := 0; n < 2; n++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		w, err := c.Watch(ctx, &healthpb.HealthCheckRequest{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := w.Recv(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		cancel()
+	}
+	if d := time.Since(start); d < 290*time.Millisecond {
+		t.Errorf("expected the streams to be throttled; took %v", d)
+	}
+}
+
+func TestQuota(t *testing.T) {
+	quota, _ := throttler.NewQuota(2, throttler.Daily, throttler.QuotaReject, time.UTC, "")
+	limiterFor := func(key string) (throttler.Limiter, error) {
+		rate, _ := throttler.NewRateByCallsPerSecond(100, 0)
+		return throttler.New(rate, 0, nil, false, throttler.WithQuota(quota))
+	}
+	i, _ := grpcthrottle.New(limiterFor)
+	c, stop := dial(t, []grpc.ServerOption{grpc.UnaryInterceptor(i.UnaryServer())}, nil)
+	defer stop()
+
+	// the calls consume the quota of the limiter
+	checkCalls(context.Background(), c, 2, t)
+	_, err := c.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	if status.Code(err) != codes.ResourceExhausted || status.Convert(err).Message() != throttler.ErrQuotaExhausted.Error() {
+		t.Errorf("expected code %v with the quota error; got %v", codes.ResourceExhausted, err)
+	}
+	if quota.Remaining() != 0 {
+		t.Errorf("expected remaining 0; got %v", quota.Remaining())
+	}
+}
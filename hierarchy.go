@@ -0,0 +1,112 @@
+package throttler
+
+import (
+	"fmt"
+	"time"
+)
+
+// attach makes parent the parent of child, so every request dispatched or
+// reserved by child also consumes a slot from parent and its ancestors
+func attach(child listener, parent listener) error {
+	c, ok := child.(*requestHandler)
+	if !ok {
+		return fmt.Errorf("unsupported child listener")
+	}
+	p, ok := parent.(*requestHandler)
+	if !ok {
+		return fmt.Errorf("unsupported parent listener")
+	}
+	c.parent = p
+	p.mu.Lock()
+	p.children = append(p.children, c)
+	p.mu.Unlock()
+	return nil
+}
+
+// chain returns the listener followed by its ancestors and their limits
+func (l *requestHandler) chain() ([]*requestHandler, []limit) {
+	var chain []*requestHandler
+	var lims []limit
+	for h := l; h != nil; h = h.parent {
+		lim, _ := h.limit()
+		chain = append(chain, h)
+		lims = append(lims, lim)
+	}
+	return chain, lims
+}
+
+// chainGates returns the gates and the booking gates of the listener followed by
+// those of its ancestors, so the requests of a child are also limited by the
+// quotas and stores of its ancestors. The breakers of the ancestors are left
+// out, since they only learn the results of their own requests.
+func (l *requestHandler) chainGates() ([]gate, []gate) {
+	gates := append([]gate(nil), l.gates...)
+	bookings := append([]gate(nil), l.bookings...)
+	for h := l.parent; h != nil; h = h.parent {
+		for _, g := range h.gates {
+			if _, ok := g.(*Breaker); !ok {
+				gates = append(gates, g)
+			}
+		}
+		bookings = append(bookings, h.bookings...)
+	}
+	return gates, bookings
+}
+
+// chainPause returns whether the listener or any of its ancestors is paused and
+// the time when all the pauses expire, which is zero if any has no deadline
+func (l *requestHandler) chainPause() (bool, time.Time) {
+	var paused bool
+	var until time.Time
+	for h := l; h != nil; h = h.parent {
+		p, u := h.pauseState()
+		if !p {
+			continue
+		}
+		if u.IsZero() {
+			return true, time.Time{}
+		}
+		if !paused || u.After(until) {
+			until = u
+		}
+		paused = true
+	}
+	return paused, until
+}
+
+// lockChain locks the listeners from the child to the root, which is the only
+// order used, so it can not deadlock
+func lockChain(chain []*requestHandler) {
+	for _, h := range chain {
+		h.mu.Lock()
+	}
+}
+
+func unlockChain(chain []*requestHandler) {
+	for i := len(chain) - 1; i >= 0; i-- {
+		chain[i].mu.Unlock()
+	}
+}
+
+// nextInChain returns the first time at or after now when every scheduler of
+// the chain allows a request of the given cost. Since every scheduler allows
+// any time after its next one, it looks for the time accepted by all of them.
+func nextInChain(chain []*requestHandler, lims []limit, now time.Time, cost int64) time.Time {
+	at := now
+	for changed := true; changed; {
+		changed = false
+		for i, h := range chain {
+			if next := h.scheduler.next(at, lims[i], cost); next.After(at) {
+				at = next
+				changed = true
+			}
+		}
+	}
+	return at
+}
+
+func commitInChain(chain []*requestHandler, lims []limit, at time.Time, cost int64) {
+	for i, h := range chain {
+		h.scheduler.commit(at, lims[i], cost)
+	}
+}
@@ -0,0 +1,157 @@
+package throttler_test
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/centraldereservas/throttler"
+)
+
+type MockLimiter struct {
+	throttler.Limiter
+}
+
+func TestWithParent(t *testing.T) {
+	tt := []struct {
+		name   string
+		parent throttler.Limiter
+		errMsg string
+	}{
+		{"Negative TC: parent nil", nil, "parent can not be nil"},
+		{"Negative TC: parent not created with New", &MockLimiter{}, "parent must be created with New"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			rate, _ := throttler.NewRateByCallsPerSecond(10, 0)
+			_, err := throttler.New(rate, 5, nil, false, throttler.WithParent(tc.parent))
+			checkError(tc.errMsg, err, t)
+		})
+	}
+}
+
+func buildHierarchy(t *testing.T, client *http.Client) (throttler.Limiter, []throttler.Limiter) {
+	parentRate, _ := throttler.NewRateByCallsPerSecond(10, 0)
+	parent, err := throttler.New(parentRate, 5, client, false)
+	if err != nil {
+		t.Fatalf("unable to create the parent throttler: %v", err)
+	}
+	var children []throttler.Limiter
+	for i := 0; i < 2; i++ {
+		childRate, _ := throttler.NewRateByCallsPerSecond(20, 0)
+		child, err := throttler.New(childRate, 5, client, false, throttler.WithParent(parent))
+		if err != nil {
+			t.Fatalf("unable to create a child throttler: %v", err)
+		}
+		children = append(children, child)
+	}
+	return parent, children
+}
+
+func TestHierarchyReserve(t *testing.T) {
+	parent, children := buildHierarchy(t, nil)
+	var slots []time.Time
+	for i := 0; i < 3; i++ {
+		for _, child := range append(children, parent) {
+			r, err := child.Reserve(context.Background(), 1)
+			if err != nil {
+				t.Fatalf("unable to reserve: %v", err)
+			}
+			defer r.Cancel()
+			slots = append(slots, r.Time())
+		}
+	}
+
+	// the children can not reserve slots closer than the parent period
+	sort.Slice(slots, func(i, j int) bool { return slots[i].Before(slots[j]) })
+	for i := 1; i < len(slots); i++ {
+		if d := slots[i].Sub(slots[i-1]); d < 100*time.Millisecond {
+			t.Errorf("slots %d and %d are only %v apart", i-1, i, d)
+		}
+	}
+}
+
+func TestHierarchyPause(t *testing.T) {
+	parent, children := buildHierarchy(t, nil)
+	parent.Pause()
+	if _, err := children[0].Reserve(context.Background(), 1); err == nil || err.Error() != "throttler is paused" {
+		t.Errorf("expected the child to be paused with its parent; got %v", err)
+	}
+	parent.Resume()
+	r, err := children[0].Reserve(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("unable to reserve: %v", err)
+	}
+	r.Cancel()
+}
+
+func TestHierarchyQueue(t *testing.T) {
+	var mu sync.Mutex
+	var sent []time.Time
+	client := &http.Client{
+		Transport: &MockTransport{
+			RoundTripMock: func(req *http.Request) (*http.Response, error) {
+				mu.Lock()
+				sent = append(sent, time.Now())
+				mu.Unlock()
+				return newMockClient(http.StatusOK).Transport.RoundTrip(req)
+			},
+		},
+	}
+	_, children := buildHierarchy(t, client)
+
+	var wg sync.WaitGroup
+	for _, child := range children {
+		child.Run()
+		for i := 0; i < 3; i++ {
+			wg.Add(1)
+			go func(child throttler.Limiter) {
+				defer wg.Done()
+				req, _ := http.NewRequest("GET", "http://example.com/", nil)
+				res, err := child.Queue(context.Background(), "child request", req, duration10s)
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+					return
+				}
+				res.Body.Close()
+			}(child)
+		}
+	}
+	wg.Wait()
+
+	// 6 requests at the parent rate of 10 calls per second take at least 500ms
+	sort.Slice(sent, func(i, j int) bool { return sent[i].Before(sent[j]) })
+	if d := sent[len(sent)-1].Sub(sent[0]); d < 450*time.Millisecond {
+		t.Errorf("expected the children to share the parent rate; all requests sent in %v", d)
+	}
+}
+
+func TestHierarchyQuota(t *testing.T) {
+	quota, _ := throttler.NewQuota(3, throttler.Daily, throttler.QuotaReject, time.UTC, "")
+	parentRate, _ := throttler.NewRateByCallsPerSecond(100, 0)
+	parent, _ := throttler.New(parentRate, 5, newMockClient(http.StatusOK), false, throttler.WithQuota(quota))
+	childRate, _ := throttler.NewRateByCallsPerSecond(100, 0)
+	child, err := throttler.New(childRate, 5, newMockClient(http.StatusOK), false, throttler.WithParent(parent))
+	if err != nil {
+		t.Fatalf("unable to create the child throttler: %v", err)
+	}
+	parent.Run()
+	child.Run()
+
+	// the requests of the child and the parent share the quota of the parent
+	for i, limiter := range []throttler.Limiter{child, parent, child} {
+		if _, err := queueStatus(limiter); err != nil {
+			t.Fatalf("unexpected error for request %d: %v", i, err)
+		}
+	}
+	if quota.Remaining() != 0 {
+		t.Errorf("expected remaining 0; got %v", quota.Remaining())
+	}
+	if _, err := queueStatus(child); err != throttler.ErrQuotaExhausted {
+		t.Errorf("expected error %v; got %v", throttler.ErrQuotaExhausted, err)
+	}
+}
@@ -2,47 +2,496 @@ package throttler
 
 import (
 	"fmt"
+	"sync"
 	"time"
 )
 
 type listener interface {
 	listen()
+	setRate(r Rate)
+	pause(until time.Time)
+	resume()
+	pauseState() (bool, time.Time)
+	reserve(cost int64) (time.Time, func(), error)
+	stop()
+}
+
+// changingRate is implemented by the rates whose value changes at known times,
+// so the listener calculates the rate again when the change happens
+type changingRate interface {
+	nextChange() time.Time
+}
+
+// gate is consulted by the listener before dispatching a request. It returns
+// the time to wait before asking again, zero if the request may be dispatched
+// now, or an error if the request must be rejected.
+type gate interface {
+	admit(req *Request) (time.Time, error)
+}
+
+// bookingGate is implemented by the gates that book a slot for the request.
+// They are consulted after the listener takes its turn, so the booked slot is
+// not delayed by the local schedule.
+type bookingGate interface {
+	gate
+	books()
+}
+
+// refundingGate is implemented by the gates that consume something when they
+// admit a request, which is given back if the request is not dispatched
+type refundingGate interface {
+	gate
+	refund(req *Request)
+}
+
+// reservingGate is implemented by the gates that also limit the reservations.
+// reserve consumes what the request needs to be granted at the given time and
+// returns the time when it can be granted, which is not before at, or an error
+// if the reservation must be rejected.
+type reservingGate interface {
+	gate
+	reserve(at time.Time, req *Request) (time.Time, error)
+}
+
+// slotGate is a bookingGate which books a slot for every request with the
+// book function the first time it is asked, and then admits the request when
+// the slot is reached
+type slotGate struct {
+	mu      sync.Mutex
+	book    func(now time.Time, cost int64) (time.Time, error)
+	pending map[*Request]time.Time
+	now     func() time.Time
+}
+
+func newSlotGate(book func(now time.Time, cost int64) (time.Time, error)) *slotGate {
+	return &slotGate{
+		book:    book,
+		pending: make(map[*Request]time.Time),
+		now:     time.Now,
+	}
+}
+
+func (g *slotGate) books() {}
+
+// reserve books the slot of a reservation at or after the given time
+func (g *slotGate) reserve(at time.Time, req *Request) (time.Time, error) {
+	slot, err := g.book(at, req.Cost)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if slot.After(at) {
+		return slot, nil
+	}
+	return at, nil
+}
+
+func (g *slotGate) admit(req *Request) (time.Time, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := g.now()
+	// the requests abandoned while waiting for their slot are forgotten
+	for r := range g.pending {
+		if r.Ctx.Err() != nil {
+			delete(g.pending, r)
+		}
+	}
+	if at, ok := g.pending[req]; ok {
+		if at.After(now) {
+			return at, nil
+		}
+		delete(g.pending, req)
+		return time.Time{}, nil
+	}
+	at, err := g.book(now, req.Cost)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !at.After(now) {
+		return time.Time{}, nil
+	}
+	g.pending[req] = at
+	return at, nil
 }
 
 type requestHandler struct {
-	rate      time.Duration
+	mu        sync.Mutex
+	rate      Rate
+	paused    bool
+	until     time.Time
+	scheduler scheduler
+	wake      chan struct{}
+	done      chan struct{}
+	stopOnce  sync.Once
 	reqChan   chan *Request
 	verbose   bool
 	fulfiller fulfiller
+	gates     []gate
+	bookings  []gate
+	parent    *requestHandler
+	children  []*requestHandler
 }
 
-func newListener(r time.Duration, ch chan *Request, v bool, f fulfiller) (listener, error) {
+func newListener(r Rate, s scheduler, ch chan *Request, v bool, f fulfiller, gates ...gate) (listener, error) {
+	if r == nil {
+		return nil, fmt.Errorf("rate can not be nil")
+	}
+	if s == nil {
+		return nil, fmt.Errorf("scheduler can not be nil")
+	}
 	if ch == nil {
 		return nil, fmt.Errorf("request channel can not be nil")
 	}
 	if f == nil {
 		return nil, fmt.Errorf("fulfiller can not be nil")
 	}
-	return &requestHandler{
+	l := &requestHandler{
 		rate:      r,
+		scheduler: s,
+		wake:      make(chan struct{}, 1),
+		done:      make(chan struct{}),
 		reqChan:   ch,
 		verbose:   v,
 		fulfiller: f,
-	}, nil
+	}
+	for _, g := range gates {
+		if _, ok := g.(bookingGate); ok {
+			l.bookings = append(l.bookings, g)
+		} else {
+			l.gates = append(l.gates, g)
+		}
+	}
+	return l, nil
 }
 
 // listen waits for receiving new requests from the requests channel and processes them
-// without exceeding the calculated maximal rate limit using the leaky bucket algorithm
+// without exceeding the calculated maximal rate limit using the scheduler algorithm,
+// until the listener is stopped
 func (l *requestHandler) listen() {
-	throttle := time.Tick(l.rate)
-	for req := range l.reqChan {
-		<-throttle
-		if l.verbose {
-			fmt.Printf("[%v] got ticket; Fulfilling Request [%v]\n", time.Now(), req.Name)
+	for {
+		select {
+		case <-l.done:
+			l.drain()
+			return
+		case req := <-l.reqChan:
+			l.handle(req)
 		}
-		go l.fulfiller.fulfill(req)
-		if l.verbose {
-			fmt.Printf("[%v] Request fulfilled [%v]\n", time.Now(), req.Name)
+	}
+}
+
+// handle waits until the request is admitted and its turn comes, and fulfills it
+func (l *requestHandler) handle(req *Request) {
+	// the requests abandoned by Queue do not take a turn
+	if req.Ctx.Err() != nil {
+		return
+	}
+	gates, bookings := l.chainGates()
+	if err := l.admit(req, gates); err != nil {
+		l.reject(req, err)
+		return
+	}
+	at, ok := l.waitTurn(req)
+	if !ok {
+		l.reject(req, ErrClosed)
+		return
+	}
+	if err := l.admit(req, bookings); err != nil {
+		l.release(at, req.Cost)
+		l.reject(req, err)
+		return
+	}
+	// the turn of a request abandoned while waiting is given back
+	if req.Ctx.Err() != nil {
+		l.release(at, req.Cost)
+		refund(req, bookings)
+		return
+	}
+	if l.verbose {
+		fmt.Printf("[%v] got ticket; Fulfilling Request [%v]\n", time.Now(), req.Name)
+	}
+	go l.fulfiller.fulfill(req)
+	if l.verbose {
+		fmt.Printf("[%v] Request fulfilled [%v]\n", time.Now(), req.Name)
+	}
+}
+
+// stop makes the listener return, failing the request being processed and the
+// ones left in the channel
+func (l *requestHandler) stop() {
+	l.stopOnce.Do(func() {
+		close(l.done)
+	})
+}
+
+// drain fails the requests left in the channel once the listener is stopped
+func (l *requestHandler) drain() {
+	for {
+		select {
+		case req := <-l.reqChan:
+			l.reject(req, ErrClosed)
+		default:
+			return
 		}
 	}
 }
+
+// reject fails the request with the error of the gate that rejected it, unless
+// the request has been abandoned
+func (l *requestHandler) reject(req *Request, err error) {
+	if req.Ctx.Err() != nil {
+		return
+	}
+	if l.verbose {
+		fmt.Printf("[%v] Request rejected [%v]: %v\n", time.Now(), req.Name, err)
+	}
+	go reject(req, err)
+}
+
+// setRate replaces the rate used by the listener and wakes it up, so a request
+// already waiting for its turn is rescheduled with the new rate
+func (l *requestHandler) setRate(r Rate) {
+	l.mu.Lock()
+	l.rate = r
+	l.mu.Unlock()
+	l.notify()
+}
+
+// pause stops dispatching requests until resume is called or, if until is not
+// zero, until that time is reached
+func (l *requestHandler) pause(until time.Time) {
+	l.mu.Lock()
+	l.paused = true
+	l.until = until
+	l.mu.Unlock()
+	l.notify()
+}
+
+// resume restarts dispatching requests after a pause
+func (l *requestHandler) resume() {
+	l.mu.Lock()
+	l.paused = false
+	l.until = time.Time{}
+	l.mu.Unlock()
+	l.notify()
+}
+
+// pauseState returns whether the listener is paused and the time when the
+// pause expires, which is zero for pauses without deadline
+func (l *requestHandler) pauseState() (bool, time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.paused && !l.until.IsZero() && !time.Now().Before(l.until) {
+		l.paused = false
+		l.until = time.Time{}
+	}
+	return l.paused, l.until
+}
+
+// notify wakes up the listener if it is waiting for its turn, as well as its
+// descendants, which take the limits of the listener into account
+func (l *requestHandler) notify() {
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+	l.mu.Lock()
+	children := l.children
+	l.mu.Unlock()
+	for _, c := range children {
+		c.notify()
+	}
+}
+
+// limit returns the limit of the current rate and the next time the rate
+// will change, which is zero if it is not known
+func (l *requestHandler) limit() (limit, time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var change time.Time
+	if c, ok := l.rate.(changingRate); ok {
+		change = c.nextChange()
+	}
+	return limitOf(l.rate), change
+}
+
+// take asks the schedulers of the listener and its ancestors for the next
+// dispatch time and commits it in all of them if it is not after now
+func (l *requestHandler) take(now time.Time, cost int64) (time.Time, bool) {
+	chain, lims := l.chain()
+	lockChain(chain)
+	defer unlockChain(chain)
+	at := nextInChain(chain, lims, now, cost)
+	if at.After(now) {
+		return at, false
+	}
+	commitInChain(chain, lims, at, cost)
+	return at, true
+}
+
+// reserve books a slot of cost units in the schedulers of the listener and its
+// ancestors, which is taken into account when dispatching the queued requests,
+// and asks the gates of the chain for the reservation like for a queued request.
+// It returns the time when the reservation is granted and the function giving
+// everything back. If the listener is paused until a given time the slot is
+// booked after the pause.
+func (l *requestHandler) reserve(cost int64) (time.Time, func(), error) {
+	paused, until := l.chainPause()
+	if paused && until.IsZero() {
+		return time.Time{}, nil, fmt.Errorf("throttler is paused")
+	}
+	now := time.Now()
+	if paused {
+		now = until
+	}
+
+	chain, lims := l.chain()
+	lockChain(chain)
+	booked := nextInChain(chain, lims, now, cost)
+	commitInChain(chain, lims, booked, cost)
+	unlockChain(chain)
+
+	req := &Request{Cost: cost}
+	gates, bookings := l.chainGates()
+	gates = append(gates, bookings...)
+	at := booked
+	for i, g := range gates {
+		r, ok := g.(reservingGate)
+		if !ok {
+			continue
+		}
+		granted, err := r.reserve(at, req)
+		if err != nil {
+			refund(req, gates[:i])
+			l.release(booked, cost)
+			return time.Time{}, nil, err
+		}
+		at = granted
+	}
+	return at, func() {
+		refund(req, gates)
+		l.release(booked, cost)
+	}, nil
+}
+
+// release gives back a reserved slot and wakes up the listeners, which might
+// dispatch their waiting requests earlier
+func (l *requestHandler) release(at time.Time, cost int64) {
+	chain, lims := l.chain()
+	lockChain(chain)
+	for i, h := range chain {
+		h.scheduler.release(at, lims[i], cost)
+	}
+	unlockChain(chain)
+	for _, h := range chain {
+		h.notify()
+	}
+}
+
+// admit blocks until every given gate admits the request, or returns the error of
+// the gate that rejects it or of abandoned, after refunding the gates that
+// already admitted it. Requests are not admitted while the listener or any of
+// its ancestors is paused.
+func (l *requestHandler) admit(req *Request, gates []gate) error {
+	for i, g := range gates {
+		for {
+			if err := l.abandoned(req); err != nil {
+				refund(req, gates[:i])
+				return err
+			}
+			if paused, until := l.chainPause(); paused {
+				l.sleep(until, req.Ctx.Done())
+				continue
+			}
+			at, err := g.admit(req)
+			if err != nil {
+				refund(req, gates[:i])
+				return err
+			}
+			if at.IsZero() {
+				break
+			}
+			l.sleep(at, req.Ctx.Done())
+		}
+	}
+	return nil
+}
+
+// abandoned returns the error of a request which must not wait anymore, because its
+// context is done or the listener is stopped
+func (l *requestHandler) abandoned(req *Request) error {
+	if err := req.Ctx.Err(); err != nil {
+		return err
+	}
+	select {
+	case <-l.done:
+		return ErrClosed
+	default:
+		return nil
+	}
+}
+
+// refund gives back what the given gates consumed when they admitted a request
+// that is not dispatched
+func refund(req *Request, gates []gate) {
+	for _, g := range gates {
+		if r, ok := g.(refundingGate); ok {
+			r.refund(req)
+		}
+	}
+}
+
+// waitTurn blocks while the listener is paused and until the scheduler allows
+// dispatching the request. It returns the time of the taken turn, or false if
+// the request is abandoned before. The rate is calculated again every time the
+// listener is woken up, which allows dynamic Rate implementations.
+func (l *requestHandler) waitTurn(req *Request) (time.Time, bool) {
+	now := time.Now()
+	for {
+		if l.abandoned(req) != nil {
+			return time.Time{}, false
+		}
+		if paused, until := l.chainPause(); paused {
+			l.sleep(until, req.Ctx.Done())
+			now = time.Now()
+			continue
+		}
+		_, change := l.limit()
+		at, ok := l.take(now, req.Cost)
+		if ok {
+			return at, true
+		}
+		if !change.IsZero() && change.Before(at) {
+			l.sleep(change, req.Ctx.Done())
+			now = time.Now()
+			continue
+		}
+		// when the timer fires the turn is taken at the scheduled time, so
+		// the delay of the timer does not accumulate over the requests
+		if l.sleep(at, req.Ctx.Done()) {
+			now = at
+		} else {
+			now = time.Now()
+		}
+	}
+}
+
+// sleep blocks until the deadline is reached, the listener is woken up or
+// stopped, or done is closed. A zero deadline is never reached. It reports
+// whether the deadline was reached.
+func (l *requestHandler) sleep(deadline time.Time, done <-chan struct{}) bool {
+	var reached <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		reached = timer.C
+	}
+	select {
+	case <-reached:
+		return true
+	case <-l.wake:
+		return false
+	case <-l.done:
+		return false
+	case <-done:
+		return false
+	}
+}
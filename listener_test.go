@@ -1,6 +1,7 @@
 package throttler
 
 import (
+	"context"
 	"io/ioutil"
 	"net/http"
 	"testing"
@@ -19,13 +20,17 @@ func TestListen(t *testing.T) {
 	tt := []struct {
 		name            string
 		reqChanCapacity int
+		rateNil         bool
+		schedulerNil    bool
 		fullfillerNil   bool
 		testData        string
 		errMsg          string
 	}{
-		{"Positive TC", 10, false, "body content", ""},
-		{"Negative TC: nil request channel", -1, false, "body content", "request channel can not be nil"},
-		{"Negative TC: nil fulfiller", 1, true, "body content", "fulfiller can not be nil"},
+		{"Positive TC", 10, false, false, false, "body content", ""},
+		{"Negative TC: nil rate", 10, true, false, false, "body content", "rate can not be nil"},
+		{"Negative TC: nil scheduler", 10, false, true, false, "body content", "scheduler can not be nil"},
+		{"Negative TC: nil request channel", -1, false, false, false, "body content", "request channel can not be nil"},
+		{"Negative TC: nil fulfiller", 1, false, false, true, "body content", "fulfiller can not be nil"},
 	}
 
 	for _, tc := range tt {
@@ -52,7 +57,16 @@ func TestListen(t *testing.T) {
 				}
 			}
 
-			listener, err := NewListener(1*time.Second, channel, false, mockFulfiller)
+			var r Rate
+			if !tc.rateNil {
+				r = &rate{Period: 1 * time.Second}
+			}
+			var s scheduler
+			if !tc.schedulerNil {
+				s = newLeakyBucket(time.Now())
+			}
+
+			listener, err := NewListener(r, s, channel, false, mockFulfiller)
 			if !checkError(tc.errMsg, err, t) {
 				go listener.listen()
 
@@ -92,6 +106,216 @@ func TestListen(t *testing.T) {
 	}
 }
 
+func TestSetRate(t *testing.T) {
+	tt := []struct {
+		name    string
+		initial time.Duration
+		updated time.Duration
+	}{
+		{"Positive TC: faster rate wakes up the waiting request", time.Hour, time.Millisecond},
+		{"Positive TC: slower rate", time.Millisecond, 2 * time.Millisecond},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			channel := make(chan *Request, 1)
+			mockFulfiller := &MockFulfiller{
+				fulfillMock: func(req *Request) {
+					req.ResChan <- createResponse(req.HReq, "")
+				},
+			}
+			listener, err := NewListener(&rate{Period: tc.initial}, newLeakyBucket(time.Now()), channel, false, mockFulfiller)
+			if err != nil {
+				t.Fatalf("unable to create a listener: %v", err)
+			}
+			go listener.listen()
+
+			req := createRequest()
+			channel <- req
+			listener.setRate(&rate{Period: tc.updated})
+
+			select {
+			case <-req.ResChan:
+			case <-time.After(5 * time.Second):
+				t.Fatalf("request not fulfilled with the updated rate")
+			}
+		})
+	}
+}
+
+func TestPause(t *testing.T) {
+	tt := []struct {
+		name     string
+		duration time.Duration
+		resume   bool
+	}{
+		{"Positive TC: pause and resume", 0, true},
+		{"Positive TC: pause until", 100 * time.Millisecond, false},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			channel := make(chan *Request, 1)
+			mockFulfiller := &MockFulfiller{
+				fulfillMock: func(req *Request) {
+					req.ResChan <- createResponse(req.HReq, "")
+				},
+			}
+			listener, err := NewListener(&rate{Period: time.Millisecond}, newLeakyBucket(time.Now()), channel, false, mockFulfiller)
+			if err != nil {
+				t.Fatalf("unable to create a listener: %v", err)
+			}
+
+			var until time.Time
+			if tc.duration > 0 {
+				until = time.Now().Add(tc.duration)
+			}
+			listener.pause(until)
+			if paused, _ := listener.pauseState(); !paused {
+				t.Fatalf("expected listener to be paused")
+			}
+			go listener.listen()
+
+			req := createRequest()
+			channel <- req
+			select {
+			case <-req.ResChan:
+				t.Fatalf("request fulfilled while paused")
+			case <-time.After(50 * time.Millisecond):
+			}
+
+			if tc.resume {
+				listener.resume()
+			}
+			select {
+			case <-req.ResChan:
+			case <-time.After(5 * time.Second):
+				t.Fatalf("request not fulfilled after the pause")
+			}
+			if paused, _ := listener.pauseState(); paused {
+				t.Errorf("expected listener not to be paused")
+			}
+		})
+	}
+}
+
+// delayGate makes the requests with the given name wait an hour
+type delayGate struct {
+	name string
+}
+
+func (g delayGate) admit(req *Request) (time.Time, error) {
+	if req.Name == g.name {
+		return time.Now().Add(time.Hour), nil
+	}
+	return time.Time{}, nil
+}
+
+func TestAbandoned(t *testing.T) {
+	tt := []struct {
+		name  string
+		pause bool
+		gates []gate
+	}{
+		{"Positive TC: abandoned while waiting the turn", false, nil},
+		{"Positive TC: abandoned while paused", true, nil},
+		{"Positive TC: abandoned while a gate delays it", false, []gate{delayGate{"abandoned"}}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			channel := make(chan *Request, 1)
+			fulfilled := make(chan string, 3)
+			mockFulfiller := &MockFulfiller{
+				fulfillMock: func(req *Request) {
+					fulfilled <- req.Name
+				},
+			}
+			period := 300 * time.Millisecond
+			start := time.Now()
+			listener, err := NewListener(&rate{Period: period}, newLeakyBucket(start), channel, false, mockFulfiller, tc.gates...)
+			if err != nil {
+				t.Fatalf("unable to create a listener: %v", err)
+			}
+			go listener.listen()
+
+			first := createRequest()
+			first.Name = "first"
+			channel <- first
+			if name := <-fulfilled; name != "first" {
+				t.Fatalf("expected the first request to be fulfilled; got %v", name)
+			}
+			sent := time.Now()
+
+			if tc.pause {
+				listener.pause(time.Time{})
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			abandoned := createRequest()
+			abandoned.Name = "abandoned"
+			abandoned.Ctx = ctx
+			channel <- abandoned
+			time.Sleep(50 * time.Millisecond)
+			cancel()
+
+			// the next request takes the turn left by the abandoned one
+			next := createRequest()
+			next.Name = "next"
+			channel <- next
+			if tc.pause {
+				listener.resume()
+			}
+			select {
+			case name := <-fulfilled:
+				if name != "next" {
+					t.Fatalf("expected the next request to be fulfilled; got %v", name)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("next request not fulfilled")
+			}
+			if d := time.Since(sent); d > period+period/2 {
+				t.Errorf("expected the next request to take the turn of the abandoned one; took %v", d)
+			}
+		})
+	}
+}
+
+func TestAdmitParentPause(t *testing.T) {
+	fulfilled := make(chan string, 1)
+	mockFulfiller := &MockFulfiller{
+		fulfillMock: func(req *Request) {
+			fulfilled <- req.Name
+		},
+	}
+	// the store slot of the request is 100ms later
+	store := newSlotGate(func(now time.Time, cost int64) (time.Time, error) {
+		return now.Add(100 * time.Millisecond), nil
+	})
+	parent, _ := NewListener(&rate{Period: time.Millisecond}, newLeakyBucket(time.Now()), make(chan *Request), false, mockFulfiller)
+	channel := make(chan *Request, 1)
+	child, _ := NewListener(&rate{Period: time.Millisecond}, newLeakyBucket(time.Now()), channel, false, mockFulfiller, store)
+	if err := attach(child, parent); err != nil {
+		t.Fatalf("unable to attach the child: %v", err)
+	}
+	go child.listen()
+
+	// the parent is paused while the child request waits for its store slot
+	channel <- createRequest()
+	time.Sleep(20 * time.Millisecond)
+	parent.pause(time.Time{})
+	select {
+	case <-fulfilled:
+		t.Fatalf("request fulfilled while the parent is paused")
+	case <-time.After(300 * time.Millisecond):
+	}
+	parent.resume()
+	select {
+	case <-fulfilled:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("request not fulfilled after the parent is resumed")
+	}
+}
+
 func checkError(errMsg string, err error, t *testing.T) bool {
 	if err != nil {
 		if errMsg == "" {
@@ -0,0 +1,74 @@
+package throttler
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// NewMiddleware returns an http.Handler middleware which limits the incoming
+// requests of every client, identified by the key function, to the rate plus
+// bursts of up to burst requests. The requests over the rate wait for their turn
+// up to maxWait (zero rejects them at once), and the ones which would wait longer
+// are rejected with 429 Too Many Requests and a Retry-After header. The turn of a
+// client which goes away while waiting is given back. If key is nil the clients
+// are identified by their IP address.
+//
+// Every response includes the RateLimit-Limit, RateLimit-Remaining and
+// RateLimit-Reset headers, with the burst, the requests which can still be sent
+// at once and the seconds until all of them are available again.
+func NewMiddleware(rate Rate, burst int, maxWait time.Duration, key func(*http.Request) string) (func(http.Handler) http.Handler, error) {
+	limiter, err := NewGCRALimiter(rate, burst)
+	if err != nil {
+		return nil, err
+	}
+	if maxWait < 0 {
+		return nil, fmt.Errorf("maxWait can not be negative")
+	}
+	if key == nil {
+		key = remoteIP
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			k := key(r)
+			res := limiter.reserveWithin(k, maxWait)
+			h := w.Header()
+			h.Set("RateLimit-Limit", strconv.Itoa(burst))
+			h.Set("RateLimit-Remaining", strconv.FormatInt(res.remaining, 10))
+			h.Set("RateLimit-Reset", strconv.FormatInt(ceilSeconds(res.reset), 10))
+			if !res.ok {
+				h.Set("Retry-After", strconv.FormatInt(ceilSeconds(res.delay), 10))
+				http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+				return
+			}
+			if res.delay > 0 {
+				timer := time.NewTimer(res.delay)
+				defer timer.Stop()
+				select {
+				case <-r.Context().Done():
+					// the client went away
+					limiter.release(k, res.tat)
+					return
+				case <-timer.C:
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}, nil
+}
+
+// remoteIP returns the IP address of the client which sent the request
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// ceilSeconds rounds the duration up to whole seconds
+func ceilSeconds(d time.Duration) int64 {
+	return int64((d + time.Second - 1) / time.Second)
+}
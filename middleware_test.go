@@ -0,0 +1,152 @@
+package throttler_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/centraldereservas/throttler"
+)
+
+func TestNewMiddleware(t *testing.T) {
+	rate, _ := throttler.NewRateByCallsPerSecond(10, 0)
+
+	tt := []struct {
+		name    string
+		rate    throttler.Rate
+		burst   int
+		maxWait time.Duration
+		errMsg  string
+	}{
+		{"Positive TC", rate, 1, 0, ""},
+		{"Negative TC: rate nil", nil, 1, 0, "rate can not be nil"},
+		{"Negative TC: burst zero", rate, 0, 0, "burst must be greater than zero"},
+		{"Negative TC: maxWait negative", rate, 1, -time.Second, "maxWait can not be negative"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := throttler.NewMiddleware(tc.rate, tc.burst, tc.maxWait, nil)
+			checkError(tc.errMsg, err, t)
+		})
+	}
+}
+
+func buildMiddleware(t *testing.T, maxWait time.Duration) http.Handler {
+	rate, _ := throttler.NewRateByCallsPerMinute(60, 0)
+	key := func(r *http.Request) string { return r.Header.Get("X-Api-Key") }
+	mw, err := throttler.NewMiddleware(rate, 2, maxWait, key)
+	if err != nil {
+		t.Fatalf("unable to create the middleware: %v", err)
+	}
+	return mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+}
+
+func serveKey(h http.Handler, key string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/hotels", nil)
+	req.Header.Set("X-Api-Key", key)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func TestMiddlewareReject(t *testing.T) {
+	h := buildMiddleware(t, 0)
+
+	tt := []struct {
+		name       string
+		key        string
+		status     int
+		remaining  string
+		reset      string
+		retryAfter string
+	}{
+		{"Positive TC: first request", "a", http.StatusNoContent, "1", "1", ""},
+		{"Positive TC: burst", "a", http.StatusNoContent, "0", "2", ""},
+		{"Negative TC: over the rate", "a", http.StatusTooManyRequests, "0", "2", "1"},
+		{"Positive TC: other key", "b", http.StatusNoContent, "1", "1", ""},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			w := serveKey(h, tc.key)
+			if w.Code != tc.status {
+				t.Errorf("expected status %d; got %d", tc.status, w.Code)
+			}
+			headers := map[string]string{
+				"RateLimit-Limit":     "2",
+				"RateLimit-Remaining": tc.remaining,
+				"RateLimit-Reset":     tc.reset,
+				"Retry-After":         tc.retryAfter,
+			}
+			for k, v := range headers {
+				if got := w.Header().Get(k); got != v {
+					t.Errorf("expected %v %q; got %q", k, v, got)
+				}
+			}
+		})
+	}
+}
+
+func TestMiddlewareWait(t *testing.T) {
+	h := buildMiddleware(t, 1500*time.Millisecond)
+	serveKey(h, "a")
+	serveKey(h, "a")
+
+	// the third request waits for its turn one second
+	type result struct {
+		code    int
+		elapsed time.Duration
+	}
+	third := make(chan result)
+	go func() {
+		start := time.Now()
+		w := serveKey(h, "a")
+		third <- result{w.Code, time.Since(start)}
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	// the fourth one would wait two seconds
+	if w := serveKey(h, "a"); w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "2" {
+		t.Errorf("expected status %d with Retry-After 2; got %d with %q", http.StatusTooManyRequests, w.Code, w.Header().Get("Retry-After"))
+	}
+	r := <-third
+	if r.code != http.StatusNoContent {
+		t.Errorf("expected status %d; got %d", http.StatusNoContent, r.code)
+	}
+	if r.elapsed < 900*time.Millisecond {
+		t.Errorf("expected the request to wait for its turn; waited %v", r.elapsed)
+	}
+}
+
+func TestMiddlewareDisconnect(t *testing.T) {
+	h := buildMiddleware(t, 1500*time.Millisecond)
+	serveKey(h, "a")
+	serveKey(h, "a")
+
+	// the third request waits for its turn one second, but its client goes away
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest("GET", "/hotels", nil).WithContext(ctx)
+	req.Header.Set("X-Api-Key", "a")
+	done := make(chan struct{})
+	go func() {
+		h.ServeHTTP(httptest.NewRecorder(), req)
+		close(done)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(500 * time.Millisecond):
+		t.Fatalf("expected the request to stop waiting when its client goes away")
+	}
+
+	// the fourth request takes the turn given back instead of waiting two seconds
+	if w := serveKey(h, "a"); w.Code != http.StatusNoContent {
+		t.Errorf("expected status %d; got %d with Retry-After %q", http.StatusNoContent, w.Code, w.Header().Get("Retry-After"))
+	}
+}
@@ -0,0 +1,189 @@
+package throttler
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Option configures optional features of the throttler created by New.
+type Option func(*throttler) error
+
+// WithQuota limits the requests dispatched per calendar window with the given Quota.
+func WithQuota(q *Quota) Option {
+	return func(t *throttler) error {
+		if q == nil {
+			return fmt.Errorf("quota can not be nil")
+		}
+		t.gates = append(t.gates, q)
+		return nil
+	}
+}
+
+// WithStrategy selects the algorithm used to schedule the requests, LeakyBucket by default.
+func WithStrategy(s Strategy) Option {
+	return func(t *throttler) error {
+		if s != LeakyBucket && s != SlidingWindowLog && s != SlidingWindowCounter && s != GCRA {
+			return fmt.Errorf("unknown strategy")
+		}
+		t.strategy = s
+		return nil
+	}
+}
+
+// WithBurst sets the number of requests that the GCRA strategy can dispatch at once, 1 by default.
+func WithBurst(burst int) Option {
+	return func(t *throttler) error {
+		if burst <= 0 {
+			return fmt.Errorf("burst must be greater than zero")
+		}
+		t.burst = burst
+		return nil
+	}
+}
+
+// WithRequestTimeout sets the timeout used by Queue when it is called with a
+// timeout of zero.
+func WithRequestTimeout(timeout time.Duration) Option {
+	return func(t *throttler) error {
+		if timeout <= 0 {
+			return fmt.Errorf("request timeout must be greater than zero")
+		}
+		t.requestTimeout = timeout
+		return nil
+	}
+}
+
+// WithCost sets the function that calculates the number of calls of the rate consumed
+// by every queued request, for instance 10 for a bulk request or 0 for a free one.
+// By default every request costs 1.
+func WithCost(cost func(*http.Request) int) Option {
+	return func(t *throttler) error {
+		if cost == nil {
+			return fmt.Errorf("cost function can not be nil")
+		}
+		t.cost = cost
+		return nil
+	}
+}
+
+// WithParent makes the throttler a child of parent, which must be created with New.
+// Every request must obtain a slot from its own throttler and from all its ancestors,
+// and is counted by their quotas, stores and daemons, so several throttlers can share
+// a common upstream budget. The breakers of the ancestors only apply to their own requests.
+func WithParent(parent Limiter) Option {
+	return func(t *throttler) error {
+		if parent == nil {
+			return fmt.Errorf("parent can not be nil")
+		}
+		p, ok := parent.(*throttler)
+		if !ok {
+			return fmt.Errorf("parent must be created with New")
+		}
+		t.parent = p
+		return nil
+	}
+}
+
+// WithStore shares the rate with the throttlers of other processes using the same
+// store and key, so that all together never exceed the rate. Every request must
+// obtain a slot from the store besides the slot of its own throttler.
+func WithStore(store Store, key string) Option {
+	return func(t *throttler) error {
+		if err := checkStore(store, key); err != nil {
+			return err
+		}
+		t.gates = append(t.gates, newSlotGate(newStoreGate(store, key, t.limit, 1).book))
+		return nil
+	}
+}
+
+func checkStore(store Store, key string) error {
+	if store == nil {
+		return fmt.Errorf("store can not be nil")
+	}
+	if key == "" {
+		return fmt.Errorf("key can not be empty")
+	}
+	return nil
+}
+
+// WithStoreLease is like WithStore, but the throttler books size slots at once
+// in the store and dispatches the requests from its local lease, which saves a
+// round trip to the store for most requests. The GuardTime of the rate is kept
+// free at the end of every slot as safety margin. Close gives the unused slots
+// back to the store.
+func WithStoreLease(store Store, key string, size int) Option {
+	return func(t *throttler) error {
+		if size <= 0 {
+			return fmt.Errorf("lease size must be greater than zero")
+		}
+		if err := checkStore(store, key); err != nil {
+			return err
+		}
+		g := newStoreGate(store, key, t.limit, int64(size))
+		t.gates = append(t.gates, newSlotGate(g.book))
+		t.closers = append(t.closers, g.close)
+		return nil
+	}
+}
+
+// WithDaemon makes every request obtain a slot from the limit of a throttling
+// daemon besides the slot of its own throttler, so the processes of a host share
+// the scheduling of the daemon.
+func WithDaemon(client *DaemonClient) Option {
+	return func(t *throttler) error {
+		if client == nil {
+			return fmt.Errorf("daemon client can not be nil")
+		}
+		t.gates = append(t.gates, newSlotGate(client.book))
+		return nil
+	}
+}
+
+// WithDiskQueue saves every queued request in the disk queue until Queue returns.
+// When the throttler is Run, the requests left pending by a previous process are
+// queued again with the given timeout and their results passed to replay, which
+// must close the response body. If replay is nil the responses are discarded.
+func WithDiskQueue(q *DiskQueue, timeout time.Duration, replay func(name string, res *http.Response, err error)) Option {
+	return func(t *throttler) error {
+		if q == nil {
+			return fmt.Errorf("disk queue can not be nil")
+		}
+		if timeout <= 0 {
+			return fmt.Errorf("timeout must be greater than zero")
+		}
+		t.disk = q
+		t.replayTimeout = timeout
+		t.onReplay = replay
+		return nil
+	}
+}
+
+// WithBreaker fails fast the queued and new requests with ErrBreakerOpen while
+// the circuit breaker is open, instead of sending them at the throttled rate to a
+// provider which is down. Once its cooldown elapses, the next request is sent at
+// its turn as probe. The breaker must not be shared with other throttlers.
+func WithBreaker(b *Breaker) Option {
+	return func(t *throttler) error {
+		if b == nil {
+			return fmt.Errorf("breaker can not be nil")
+		}
+		t.breaker = b
+		return nil
+	}
+}
+
+// WithBandwidth paces the request bodies sent by the throttler with upload and the
+// response bodies with download, any of which may be nil, wrapping the transport
+// of its http.Client.
+func WithBandwidth(upload *Bandwidth, download *Bandwidth) Option {
+	return func(t *throttler) error {
+		if upload == nil && download == nil {
+			return fmt.Errorf("upload and download can not be both nil")
+		}
+		t.upload = upload
+		t.download = download
+		return nil
+	}
+}
@@ -0,0 +1,78 @@
+package throttler
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// rateUnits are the time references accepted by ParseRate after the slash.
+var rateUnits = map[string]time.Duration{
+	"s":      time.Second,
+	"sec":    time.Second,
+	"second": time.Second,
+	"m":      time.Minute,
+	"min":    time.Minute,
+	"minute": time.Minute,
+	"h":      time.Hour,
+	"hour":   time.Hour,
+	"d":      24 * time.Hour,
+	"day":    24 * time.Hour,
+}
+
+// ParseRate initializes the Rate described by a string with the format
+// "calls/unit[+guardTime]", where calls is an integer or decimal number, unit
+// is one of s, sec, second, m, min, minute, h, hour, d, day or a duration like
+// 10s, and guardTime is an optional duration. For instance "120/min+50ms",
+// "150/10s" or "2.5/s".
+func ParseRate(s string) (Rate, error) {
+	s = strings.Replace(s, " ", "", -1)
+	period, guard := s, ""
+	if i := strings.Index(s, "+"); i >= 0 {
+		period, guard = s[:i], s[i+1:]
+	}
+
+	parts := strings.Split(period, "/")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid rate %q: expected calls/unit", s)
+	}
+	calls, ok := new(big.Rat).SetString(parts[0])
+	if !ok {
+		return nil, fmt.Errorf("invalid rate %q: calls must be a number", s)
+	}
+	timeReference, err := parseRateUnit(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid rate %q: %v", s, err)
+	}
+
+	// calls = num / denom per unit is the same as num calls per denom units
+	num, denom := calls.Num(), calls.Denom()
+	if !num.IsInt64() || !denom.IsInt64() || num.Int64() > math.MaxInt32 || denom.Int64() > math.MaxInt64/int64(timeReference) {
+		return nil, fmt.Errorf("invalid rate %q: calls out of range", s)
+	}
+
+	var guardTime time.Duration
+	if guard != "" {
+		guardTime, err = time.ParseDuration(guard)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rate %q: %v", s, err)
+		}
+	}
+	return newRate(int(num.Int64()), guardTime, timeReference*time.Duration(denom.Int64()))
+}
+
+func parseRateUnit(unit string) (time.Duration, error) {
+	if d, ok := rateUnits[strings.ToLower(unit)]; ok {
+		return d, nil
+	}
+	d, err := time.ParseDuration(unit)
+	if err != nil {
+		return 0, fmt.Errorf("unknown unit %q", unit)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("unit must be greater than zero")
+	}
+	return d, nil
+}
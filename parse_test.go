@@ -0,0 +1,44 @@
+package throttler_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/centraldereservas/throttler"
+)
+
+func TestParseRate(t *testing.T) {
+	tt := []struct {
+		name                 string
+		rate                 string
+		expectedRateDuration time.Duration
+		errMsg               string
+	}{
+		{"Positive TC: calls per minute with guard time", "120/min+50ms", 550 * time.Millisecond, ""},
+		{"Positive TC: calls per second", "2/s", duration500ms, ""},
+		{"Positive TC: calls per hour with spaces", "2 / hour + 5m", duration35min, ""},
+		{"Positive TC: calls per duration", "150/10s", 66666666 * time.Nanosecond, ""},
+		{"Negative TC: missing unit", "120", 0, `invalid rate "120": expected calls/unit`},
+		{"Positive TC: decimal calls", "2.5/s", 400 * time.Millisecond, ""},
+		{"Positive TC: one call every 90 seconds", "1/90s", 90 * time.Second, ""},
+		{"Negative TC: calls not a number", "a/s", 0, `invalid rate "a/s": calls must be a number`},
+		{"Negative TC: calls out of range", "0.000000000000000000001/h", 0, `invalid rate "0.000000000000000000001/h": calls out of range`},
+		{"Negative TC: unknown unit", "2/week", 0, `invalid rate "2/week": unknown unit "week"`},
+		{"Negative TC: negative unit", "2/-1s", 0, `invalid rate "2/-1s": unit must be greater than zero`},
+		{"Negative TC: invalid guard time", "2/s+x", 0, `invalid rate "2/s+x": time: invalid duration "x"`},
+		{"Negative TC: calls zero", "0/s", 0, "maxCalls must be greater than zero"},
+		{"Negative TC: negative guard time", "2/s+-5ms", 0, "guardTime must be greater or equal than zero"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			rate, err := throttler.ParseRate(tc.rate)
+			if !checkError(tc.errMsg, err, t) {
+				rateDuration := rate.CalculateRate()
+				if rateDuration != tc.expectedRateDuration {
+					t.Errorf("expected rate duration %v; got %v", tc.expectedRateDuration, rateDuration)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package throttler_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/centraldereservas/throttler"
+)
+
+// queuePaused queues the named requests in a paused throttler and returns the
+// channels receiving the errors of Queue in the same order
+func queuePaused(limiter throttler.Limiter, names ...string) []chan error {
+	var errs []chan error
+	for _, name := range names {
+		c := make(chan error, 1)
+		errs = append(errs, c)
+		go func(name string) {
+			req, _ := http.NewRequest("GET", "http://example.com/", nil)
+			res, err := limiter.Queue(context.Background(), name, req, duration10s)
+			if err == nil {
+				res.Body.Close()
+			}
+			c <- err
+		}(name)
+		time.Sleep(20 * time.Millisecond)
+	}
+	return errs
+}
+
+func TestPending(t *testing.T) {
+	rate, _ := throttler.NewRateByCallsPerSecond(100, 0)
+	limiter, _ := throttler.New(rate, 5, newMockClient(http.StatusOK), false)
+	limiter.Run()
+	limiter.Pause()
+	start := time.Now()
+	errs := queuePaused(limiter, "first", "second", "third")
+
+	pending := limiter.Pending()
+	if len(pending) != 3 {
+		t.Fatalf("expected 3 pending requests; got %+v", pending)
+	}
+	for i, name := range []string{"first", "second", "third"} {
+		p := pending[i]
+		if p.Name != name || p.Position != i {
+			t.Errorf("expected %q at position %d; got %+v", name, i, p)
+		}
+		if i > 0 && p.ID <= pending[i-1].ID {
+			t.Errorf("expected increasing IDs; got %+v", pending)
+		}
+		if p.QueuedAt.Before(start) || p.Deadline.Sub(p.QueuedAt) > duration10s || p.Deadline.Sub(start) < duration10s {
+			t.Errorf("unexpected times %+v", p)
+		}
+	}
+
+	limiter.Resume()
+	for i, c := range errs {
+		if err := <-c; err != nil {
+			t.Errorf("unexpected error for request %d: %v", i, err)
+		}
+	}
+	if pending := limiter.Pending(); len(pending) != 0 {
+		t.Errorf("expected no pending requests; got %+v", pending)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	rate, _ := throttler.NewRateByCallsPerSecond(100, 0)
+	limiter, _ := throttler.New(rate, 5, newMockClient(http.StatusOK), false)
+	limiter.Run()
+	limiter.Pause()
+	errs := queuePaused(limiter, "search", "book", "search", "pay")
+	pending := limiter.Pending()
+	if len(pending) != 4 {
+		t.Fatalf("expected 4 pending requests; got %+v", pending)
+	}
+
+	if !limiter.CancelByID(pending[1].ID) {
+		t.Errorf("expected request %d to be cancelled", pending[1].ID)
+	}
+	if limiter.CancelByID(pending[1].ID) {
+		t.Errorf("expected request %d to be already cancelled", pending[1].ID)
+	}
+	if limiter.CancelByID(12345) {
+		t.Errorf("expected an unknown request not to be cancelled")
+	}
+	if err := <-errs[1]; err != throttler.ErrCancelled {
+		t.Errorf("expected error %v; got %v", throttler.ErrCancelled, err)
+	}
+
+	if n := limiter.CancelByName("search"); n != 2 {
+		t.Errorf("expected 2 cancelled requests; got %d", n)
+	}
+	if n := limiter.CancelByName("unknown"); n != 0 {
+		t.Errorf("expected no cancelled requests; got %d", n)
+	}
+	for _, i := range []int{0, 2} {
+		if err := <-errs[i]; err != throttler.ErrCancelled {
+			t.Errorf("expected error %v; got %v", throttler.ErrCancelled, err)
+		}
+	}
+
+	pending = limiter.Pending()
+	if len(pending) != 1 || pending[0].Name != "pay" || pending[0].Position != 0 {
+		t.Errorf("expected only pay to be pending; got %+v", pending)
+	}
+
+	// the cancelled requests do not take a turn of the rate
+	limiter.Resume()
+	if err := <-errs[3]; err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if n := limiter.CancelByName("pay"); n != 0 {
+		t.Errorf("expected sent requests not to be cancelled; got %d", n)
+	}
+}
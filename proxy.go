@@ -0,0 +1,249 @@
+package throttler
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// hopHeaders are the headers of a single connection, which are not forwarded by the proxy
+var hopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// proxyHandler sends the incoming requests to their upstream host through the
+// limiter of that host
+type proxyHandler struct {
+	mu         sync.Mutex
+	limiters   map[string]*list.Element
+	recent     *list.List
+	maxHosts   int
+	limiterFor func(host string) (Limiter, error)
+	upstream   *url.URL
+	timeout    time.Duration
+}
+
+// proxyLimiter is the limiter of a host, kept in the list of the recently used ones
+type proxyLimiter struct {
+	host    string
+	limiter Limiter
+	active  int
+}
+
+// NewProxy returns a throttling proxy, which sends every request through the
+// Limiter of its upstream host and returns the upstream response. Requests with
+// an absolute URL, sent by clients configured to use it as HTTP proxy, are
+// forwarded to their host. The rest are sent to upstream (reverse proxy mode), or
+// rejected if upstream is nil. The limiter of every host is created by limiterFor
+// on its first request and Run by the proxy; its http.Client should not follow
+// redirects, so they are returned to the client. At most maxHosts limiters are
+// kept: the least recently used one without requests is closed when the limiter
+// of a new host is created, or later once its requests are done. HTTPS tunnels
+// (CONNECT) can not be throttled per request and are rejected.
+func NewProxy(limiterFor func(host string) (Limiter, error), upstream *url.URL, timeout time.Duration, maxHosts int) (http.Handler, error) {
+	if limiterFor == nil {
+		return nil, fmt.Errorf("limiterFor can not be nil")
+	}
+	if upstream != nil && (upstream.Scheme == "" || upstream.Host == "") {
+		return nil, fmt.Errorf("upstream must be an absolute URL")
+	}
+	if timeout <= 0 {
+		return nil, fmt.Errorf("timeout must be greater than zero")
+	}
+	if maxHosts <= 0 {
+		return nil, fmt.Errorf("maxHosts must be greater than zero")
+	}
+	return &proxyHandler{
+		limiters:   make(map[string]*list.Element),
+		recent:     list.New(),
+		maxHosts:   maxHosts,
+		limiterFor: limiterFor,
+		upstream:   upstream,
+		timeout:    timeout,
+	}, nil
+}
+
+func (p *proxyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodConnect {
+		http.Error(w, "CONNECT is not supported", http.StatusMethodNotAllowed)
+		return
+	}
+	target, err := p.target(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	l, release, err := p.limiter(target.Host)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer release()
+
+	out, err := http.NewRequest(r.Method, target.String(), r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	out.ContentLength = r.ContentLength
+	copyHeader(out.Header, r.Header)
+	if ip, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		if prior := r.Header.Get("X-Forwarded-For"); prior != "" {
+			ip = prior + ", " + ip
+		}
+		out.Header.Set("X-Forwarded-For", ip)
+	}
+
+	res, err := l.Queue(r.Context(), r.Method+" "+target.String(), out, p.timeout)
+	if err != nil {
+		http.Error(w, err.Error(), proxyStatus(err))
+		return
+	}
+	defer res.Body.Close()
+	copyHeader(w.Header(), res.Header)
+	w.WriteHeader(res.StatusCode)
+	io.Copy(w, res.Body)
+}
+
+// target returns the upstream URL of the request
+func (p *proxyHandler) target(r *http.Request) (*url.URL, error) {
+	if r.URL.IsAbs() {
+		if r.URL.Scheme != "http" && r.URL.Scheme != "https" {
+			return nil, fmt.Errorf("unsupported scheme %q", r.URL.Scheme)
+		}
+		u := *r.URL
+		return &u, nil
+	}
+	if p.upstream == nil {
+		return nil, fmt.Errorf("absolute URL required")
+	}
+	u := *p.upstream
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + strings.TrimPrefix(r.URL.Path, "/")
+	u.RawPath = ""
+	if u.RawQuery == "" || r.URL.RawQuery == "" {
+		u.RawQuery += r.URL.RawQuery
+	} else {
+		u.RawQuery += "&" + r.URL.RawQuery
+	}
+	return &u, nil
+}
+
+// limiter returns the limiter of the host, creating and running it on its first
+// request, and the function to call once the request is done with it. When there
+// are more than maxHosts limiters the least recently used idle ones are removed
+// and closed.
+func (p *proxyHandler) limiter(host string) (Limiter, func(), error) {
+	p.mu.Lock()
+	e, ok := p.limiters[host]
+	if ok {
+		p.recent.MoveToFront(e)
+	} else {
+		l, err := p.limiterFor(host)
+		if err != nil {
+			p.mu.Unlock()
+			return nil, nil, fmt.Errorf("unable to create the limiter of %v: %v", host, err)
+		}
+		if l == nil {
+			p.mu.Unlock()
+			return nil, nil, fmt.Errorf("unable to create the limiter of %v: limiter can not be nil", host)
+		}
+		l.Run()
+		e = p.recent.PushFront(&proxyLimiter{host: host, limiter: l})
+		p.limiters[host] = e
+	}
+	pl := e.Value.(*proxyLimiter)
+	pl.active++
+	evicted := p.evict()
+	p.mu.Unlock()
+
+	closeLimiters(evicted)
+	return pl.limiter, func() { p.release(pl) }, nil
+}
+
+// release marks the end of a request sent through the limiter, which can be
+// evicted once it has no more requests
+func (p *proxyHandler) release(pl *proxyLimiter) {
+	p.mu.Lock()
+	pl.active--
+	evicted := p.evict()
+	p.mu.Unlock()
+
+	closeLimiters(evicted)
+}
+
+// evict removes the least recently used limiters without requests while there
+// are more than maxHosts, and returns them to be closed. The limiters with
+// requests are kept until they are done, so they do not fail because of the
+// requests to other hosts.
+func (p *proxyHandler) evict() []Limiter {
+	var evicted []Limiter
+	for e := p.recent.Back(); e != nil && p.recent.Len() > p.maxHosts; {
+		prev := e.Prev()
+		if pl := e.Value.(*proxyLimiter); pl.active == 0 {
+			p.recent.Remove(e)
+			delete(p.limiters, pl.host)
+			evicted = append(evicted, pl.limiter)
+		}
+		e = prev
+	}
+	return evicted
+}
+
+// closeLimiters closes the evicted limiters
+func closeLimiters(limiters []Limiter) {
+	for _, l := range limiters {
+		l.Close()
+	}
+}
+
+// proxyStatus returns the status code of the response to a request which failed
+func proxyStatus(err error) int {
+	switch {
+	case err == ErrQuotaExhausted:
+		return http.StatusTooManyRequests
+	case err == ErrClosed:
+		return http.StatusServiceUnavailable
+	case err == context.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	}
+	if uerr, ok := err.(*url.Error); ok && uerr.Timeout() {
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusBadGateway
+}
+
+// copyHeader adds the headers of src to dst, except the hop-by-hop ones
+func copyHeader(dst http.Header, src http.Header) {
+	skip := make(map[string]bool)
+	for _, h := range hopHeaders {
+		skip[h] = true
+	}
+	for _, f := range strings.Split(src.Get("Connection"), ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			skip[http.CanonicalHeaderKey(f)] = true
+		}
+	}
+	for k, vv := range src {
+		if skip[k] {
+			continue
+		}
+		for _, v := range vv {
+			dst.Add(k, v)
+		}
+	}
+}
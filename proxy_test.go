@@ -0,0 +1,253 @@
+package throttler_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/centraldereservas/throttler"
+)
+
+func TestNewProxy(t *testing.T) {
+	limiterFor := func(host string) (throttler.Limiter, error) { return nil, nil }
+	upstream, _ := url.Parse("http://example.com")
+	relative, _ := url.Parse("/api")
+
+	tt := []struct {
+		name       string
+		limiterFor func(host string) (throttler.Limiter, error)
+		upstream   *url.URL
+		timeout    time.Duration
+		maxHosts   int
+		errMsg     string
+	}{
+		{"Positive TC: forward proxy", limiterFor, nil, duration10s, 10, ""},
+		{"Positive TC: reverse proxy", limiterFor, upstream, duration10s, 1, ""},
+		{"Negative TC: limiterFor nil", nil, nil, duration10s, 10, "limiterFor can not be nil"},
+		{"Negative TC: relative upstream", limiterFor, relative, duration10s, 10, "upstream must be an absolute URL"},
+		{"Negative TC: timeout zero", limiterFor, nil, 0, 10, "timeout must be greater than zero"},
+		{"Negative TC: maxHosts zero", limiterFor, nil, duration10s, 0, "maxHosts must be greater than zero"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := throttler.NewProxy(tc.limiterFor, tc.upstream, tc.timeout, tc.maxHosts)
+			checkError(tc.errMsg, err, t)
+		})
+	}
+}
+
+// buildProxy returns a proxy to an upstream server which echoes the requests,
+// and the number of limiters created per host
+func buildProxy(t *testing.T, reverse bool) (*httptest.Server, http.Handler, map[string]int) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("X-Path", r.URL.RequestURI())
+		w.Header().Set("X-Forwarded-For", r.Header.Get("X-Forwarded-For"))
+		w.Header().Set("X-Connection", r.Header.Get("Connection"))
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, "%v %s", r.Method, body)
+	}))
+	var mu sync.Mutex
+	created := make(map[string]int)
+	limiterFor := func(host string) (throttler.Limiter, error) {
+		mu.Lock()
+		created[host]++
+		mu.Unlock()
+		rate, _ := throttler.NewRateByCallsPerSecond(10, 0)
+		return throttler.New(rate, 5, nil, false)
+	}
+	var upstream *url.URL
+	if reverse {
+		upstream, _ = url.Parse(server.URL + "/api")
+	}
+	proxy, err := throttler.NewProxy(limiterFor, upstream, duration10s, 10)
+	if err != nil {
+		t.Fatalf("unable to create the proxy: %v", err)
+	}
+	return server, proxy, created
+}
+
+func TestProxy(t *testing.T) {
+	server, forward, created := buildProxy(t, false)
+	defer server.Close()
+	_, reverse, _ := buildProxy(t, true)
+
+	tt := []struct {
+		name   string
+		proxy  http.Handler
+		method string
+		target string
+		status int
+		body   string
+		path   string
+	}{
+		{"Positive TC: forward GET", forward, "GET", server.URL + "/hotels?id=1", http.StatusCreated, "GET ", "/hotels?id=1"},
+		{"Positive TC: forward POST", forward, "POST", server.URL + "/bookings", http.StatusCreated, "POST {\"hotel\":1}", "/bookings"},
+		{"Positive TC: reverse", reverse, "GET", "/hotels?id=1", http.StatusCreated, "GET ", "/api/hotels?id=1"},
+		{"Negative TC: relative URL without upstream", forward, "GET", "/hotels", http.StatusBadRequest, "absolute URL required\n", ""},
+		{"Negative TC: CONNECT", forward, "CONNECT", "example.com:443", http.StatusMethodNotAllowed, "CONNECT is not supported\n", ""},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var body *strings.Reader
+			if tc.method == "POST" {
+				body = strings.NewReader(`{"hotel":1}`)
+			} else {
+				body = strings.NewReader("")
+			}
+			req := httptest.NewRequest(tc.method, tc.target, body)
+			req.Header.Set("Connection", "close")
+			w := httptest.NewRecorder()
+			tc.proxy.ServeHTTP(w, req)
+			if w.Code != tc.status {
+				t.Errorf("expected status %d; got %d", tc.status, w.Code)
+			}
+			if w.Body.String() != tc.body {
+				t.Errorf("expected body %q; got %q", tc.body, w.Body.String())
+			}
+			if tc.path == "" {
+				return
+			}
+			if p := w.Header().Get("X-Path"); p != tc.path {
+				t.Errorf("expected upstream path %q; got %q", tc.path, p)
+			}
+			if ip := w.Header().Get("X-Forwarded-For"); ip != "192.0.2.1" {
+				t.Errorf("expected X-Forwarded-For %q; got %q", "192.0.2.1", ip)
+			}
+			if c := w.Header().Get("X-Connection"); c != "" {
+				t.Errorf("expected the Connection header not to be forwarded; got %q", c)
+			}
+		})
+	}
+
+	u, _ := url.Parse(server.URL)
+	if created[u.Host] != 1 {
+		t.Errorf("expected one limiter for %v; got %d", u.Host, created[u.Host])
+	}
+}
+
+func TestProxyRate(t *testing.T) {
+	server, proxy, _ := buildProxy(t, false)
+	defer server.Close()
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			proxy.ServeHTTP(w, httptest.NewRequest("GET", server.URL+"/hotels", nil))
+			if w.Code != http.StatusCreated {
+				t.Errorf("expected status %d; got %d", http.StatusCreated, w.Code)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// 3 requests at 10 calls per second take at least 200ms
+	if d := time.Since(start); d < 190*time.Millisecond {
+		t.Errorf("expected the requests to be throttled; all sent in %v", d)
+	}
+}
+
+func TestProxyLimiterError(t *testing.T) {
+	limiterFor := func(host string) (throttler.Limiter, error) {
+		return nil, fmt.Errorf("unknown host")
+	}
+	proxy, _ := throttler.NewProxy(limiterFor, nil, duration10s, 10)
+	w := httptest.NewRecorder()
+	proxy.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/", nil))
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("expected status %d; got %d", http.StatusBadGateway, w.Code)
+	}
+	if b := w.Body.String(); b != "unable to create the limiter of example.com: unknown host\n" {
+		t.Errorf("unexpected body %q", b)
+	}
+}
+
+func TestProxyMaxHosts(t *testing.T) {
+	limiters := make(map[string][]throttler.Limiter)
+	limiterFor := func(host string) (throttler.Limiter, error) {
+		rate, _ := throttler.NewRateByCallsPerSecond(100, 0)
+		l, err := throttler.New(rate, 5, newMockClient(http.StatusOK), false)
+		limiters[host] = append(limiters[host], l)
+		return l, err
+	}
+	proxy, _ := throttler.NewProxy(limiterFor, nil, duration10s, 2)
+
+	// c evicts b, the least recently used host, and b evicts a
+	for _, host := range []string{"a", "b", "a", "c", "b"} {
+		w := httptest.NewRecorder()
+		proxy.ServeHTTP(w, httptest.NewRequest("GET", "http://"+host+".example.com/", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status %d for host %v; got %d", http.StatusOK, host, w.Code)
+		}
+	}
+	for host, n := range map[string]int{"a": 1, "b": 2, "c": 1} {
+		if len(limiters[host+".example.com"]) != n {
+			t.Errorf("expected %d limiters of host %v; got %d", n, host, len(limiters[host+".example.com"]))
+		}
+	}
+
+	// the evicted limiters are closed
+	for _, l := range []throttler.Limiter{limiters["a.example.com"][0], limiters["b.example.com"][0]} {
+		if _, err := queueStatus(l); err != throttler.ErrClosed {
+			t.Errorf("expected error %v; got %v", throttler.ErrClosed, err)
+		}
+	}
+	if _, err := queueStatus(limiters["b.example.com"][1]); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestProxyMaxHostsBusy(t *testing.T) {
+	limiters := make(map[string]throttler.Limiter)
+	limiterFor := func(host string) (throttler.Limiter, error) {
+		rate, _ := throttler.NewRateByCallsPerSecond(100, 0)
+		l, err := throttler.New(rate, 5, newMockClient(http.StatusOK), false)
+		limiters[host] = l
+		return l, err
+	}
+	proxy, _ := throttler.NewProxy(limiterFor, nil, duration10s, 2)
+	serve := func(host string) int {
+		w := httptest.NewRecorder()
+		proxy.ServeHTTP(w, httptest.NewRequest("GET", "http://"+host+".example.com/", nil))
+		return w.Code
+	}
+	serve("a")
+
+	// a holds a request, so c evicts b although a is the least recently used host
+	limiters["a.example.com"].Pause()
+	held := make(chan int, 1)
+	go func() { held <- serve("a") }()
+	time.Sleep(20 * time.Millisecond)
+	serve("b")
+	serve("c")
+	if _, err := queueStatus(limiters["b.example.com"]); err != throttler.ErrClosed {
+		t.Errorf("expected the idle limiter to be closed; got %v", err)
+	}
+	limiters["a.example.com"].Resume()
+	select {
+	case code := <-held:
+		if code != http.StatusOK {
+			t.Errorf("expected status %d for the held request; got %d", http.StatusOK, code)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("the held request was not sent")
+	}
+
+	// a is evicted once its request is done
+	serve("b")
+	if _, err := queueStatus(limiters["a.example.com"]); err != throttler.ErrClosed {
+		t.Errorf("expected the least recently used limiter to be closed; got %v", err)
+	}
+}
@@ -0,0 +1,233 @@
+package throttler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrQuotaExhausted is returned by Queue when the request is rejected because
+// the quota of the current window has been consumed.
+var ErrQuotaExhausted = errors.New("quota exhausted")
+
+// QuotaPeriod is the calendar window in which a Quota counts the requests.
+type QuotaPeriod int
+
+const (
+	// Daily windows start every day at midnight
+	Daily QuotaPeriod = iota
+	// Monthly windows start the first day of every month at midnight
+	Monthly
+)
+
+// QuotaPolicy decides what happens with the requests once the quota is exhausted.
+type QuotaPolicy int
+
+const (
+	// QuotaReject fails the requests with ErrQuotaExhausted
+	QuotaReject QuotaPolicy = iota
+	// QuotaDelay holds the requests until the next window starts
+	QuotaDelay
+)
+
+// Quota counts the dispatched requests per calendar window and limits them to
+// a maximal number. The counter can be persisted to a local file so that it
+// survives restarts of the process.
+type Quota struct {
+	mu       sync.Mutex
+	limit    int
+	period   QuotaPeriod
+	policy   QuotaPolicy
+	location *time.Location
+	path     string
+	start    time.Time
+	count    int
+	counted  map[*Request]time.Time
+	now      func() time.Time
+}
+
+type quotaFile struct {
+	WindowStart time.Time `json:"window_start"`
+	Count       int       `json:"count"`
+}
+
+// NewQuota initializes a Quota that allows limit requests per period, where the windows
+// are calculated in the given location (time.Local if nil). If path is not empty the
+// counter is loaded from and saved into that file.
+func NewQuota(limit int, period QuotaPeriod, policy QuotaPolicy, location *time.Location, path string) (*Quota, error) {
+	if limit <= 0 {
+		return nil, fmt.Errorf("limit must be greater than zero")
+	}
+	if period != Daily && period != Monthly {
+		return nil, fmt.Errorf("unknown quota period")
+	}
+	if policy != QuotaReject && policy != QuotaDelay {
+		return nil, fmt.Errorf("unknown quota policy")
+	}
+	if location == nil {
+		location = time.Local
+	}
+	q := &Quota{
+		limit:    limit,
+		period:   period,
+		policy:   policy,
+		location: location,
+		path:     path,
+		counted:  make(map[*Request]time.Time),
+		now:      time.Now,
+	}
+	if err := q.load(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// Remaining returns the number of requests that can still be dispatched in the current window.
+func (q *Quota) Remaining() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.roll(q.now())
+	return q.limit - q.count
+}
+
+// ResetAt returns the time when the current window finishes and the counter is reset.
+func (q *Quota) ResetAt() time.Time {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.roll(q.now())
+	return q.windowEnd()
+}
+
+// books makes the listener consult the quota once the request has taken its turn, so the
+// requests abandoned while waiting do not consume it.
+func (q *Quota) books() {}
+
+// admit consumes the cost of the request from the quota. When the quota is exhausted it returns the
+// time of the next window if the policy is QuotaDelay, or ErrQuotaExhausted otherwise.
+func (q *Quota) admit(req *Request) (time.Time, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.roll(q.now())
+	cost := int(req.Cost)
+	if q.count+cost > q.limit {
+		if q.policy == QuotaDelay && cost <= q.limit {
+			return q.windowEnd(), nil
+		}
+		return time.Time{}, ErrQuotaExhausted
+	}
+	if cost == 0 {
+		return time.Time{}, nil
+	}
+	q.count += cost
+	if err := q.save(); err != nil {
+		q.count -= cost
+		return time.Time{}, err
+	}
+	q.counted[req] = q.start
+	return time.Time{}, nil
+}
+
+// reserve consumes the cost of a reservation. Reservations are rejected with
+// ErrQuotaExhausted once the quota is exhausted, whatever the policy.
+func (q *Quota) reserve(at time.Time, req *Request) (time.Time, error) {
+	next, err := q.admit(req)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !next.IsZero() {
+		return time.Time{}, ErrQuotaExhausted
+	}
+	return at, nil
+}
+
+// refund gives back the cost of a request that is not dispatched after being admitted,
+// unless it was counted in a previous window
+func (q *Quota) refund(req *Request) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.roll(q.now())
+	start, ok := q.counted[req]
+	delete(q.counted, req)
+	cost := int(req.Cost)
+	if !ok || !start.Equal(q.start) || cost == 0 || q.count < cost {
+		return
+	}
+	q.count -= cost
+	if err := q.save(); err != nil {
+		q.count += cost
+	}
+}
+
+// roll resets the counter when t belongs to a window after the current one. The
+// requests counted in the previous window can not be refunded anymore, so they are
+// forgotten.
+func (q *Quota) roll(t time.Time) {
+	start := q.windowStart(t)
+	if !start.Equal(q.start) {
+		q.start = start
+		q.count = 0
+		q.counted = make(map[*Request]time.Time)
+	}
+}
+
+func (q *Quota) windowStart(t time.Time) time.Time {
+	t = t.In(q.location)
+	if q.period == Monthly {
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, q.location)
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, q.location)
+}
+
+func (q *Quota) windowEnd() time.Time {
+	if q.period == Monthly {
+		return q.start.AddDate(0, 1, 0)
+	}
+	return q.start.AddDate(0, 0, 1)
+}
+
+// load reads the counter from the file, it is ignored if it belongs to a past window
+func (q *Quota) load() error {
+	q.roll(q.now())
+	if q.path == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(q.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to read the quota file: %v", err)
+	}
+	var f quotaFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return fmt.Errorf("unable to parse the quota file: %v", err)
+	}
+	if f.WindowStart.Equal(q.start) {
+		q.count = f.Count
+	}
+	return nil
+}
+
+// save writes the counter into a temporary file which replaces the quota file,
+// so the file is never left half written
+func (q *Quota) save() error {
+	if q.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(quotaFile{WindowStart: q.start, Count: q.count})
+	if err != nil {
+		return fmt.Errorf("unable to encode the quota file: %v", err)
+	}
+	tmp := q.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("unable to write the quota file: %v", err)
+	}
+	if err := os.Rename(tmp, q.path); err != nil {
+		return fmt.Errorf("unable to write the quota file: %v", err)
+	}
+	return nil
+}
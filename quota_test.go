@@ -0,0 +1,256 @@
+package throttler
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNewQuota(t *testing.T) {
+	tt := []struct {
+		name   string
+		limit  int
+		period QuotaPeriod
+		policy QuotaPolicy
+		errMsg string
+	}{
+		{"Positive TC", 10, Daily, QuotaReject, ""},
+		{"Negative TC: limit zero", 0, Daily, QuotaReject, "limit must be greater than zero"},
+		{"Negative TC: unknown period", 10, QuotaPeriod(7), QuotaReject, "unknown quota period"},
+		{"Negative TC: unknown policy", 10, Monthly, QuotaPolicy(7), "unknown quota policy"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			q, err := NewQuota(tc.limit, tc.period, tc.policy, time.UTC, "")
+			if !checkError(tc.errMsg, err, t) && q.Remaining() != tc.limit {
+				t.Errorf("expected remaining %v; got %v", tc.limit, q.Remaining())
+			}
+		})
+	}
+}
+
+func TestQuotaAdmit(t *testing.T) {
+	now := time.Date(2026, 10, 19, 15, 30, 0, 0, time.UTC)
+	tt := []struct {
+		name            string
+		period          QuotaPeriod
+		policy          QuotaPolicy
+		expectedResetAt time.Time
+		errMsg          string
+	}{
+		{"Negative TC: daily quota rejected", Daily, QuotaReject, time.Date(2026, 10, 20, 0, 0, 0, 0, time.UTC), "quota exhausted"},
+		{"Negative TC: monthly quota rejected", Monthly, QuotaReject, time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC), "quota exhausted"},
+		{"Positive TC: daily quota delayed", Daily, QuotaDelay, time.Date(2026, 10, 20, 0, 0, 0, 0, time.UTC), ""},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			q, err := NewQuota(2, tc.period, tc.policy, time.UTC, "")
+			if err != nil {
+				t.Fatalf("unable to create a quota: %v", err)
+			}
+			q.now = func() time.Time { return now }
+
+			for i := 0; i < 2; i++ {
+				if at, err := q.admit(createRequest()); err != nil || !at.IsZero() {
+					t.Fatalf("request %d not admitted: %v, %v", i, at, err)
+				}
+			}
+			if q.Remaining() != 0 {
+				t.Errorf("expected remaining 0; got %v", q.Remaining())
+			}
+			if !q.ResetAt().Equal(tc.expectedResetAt) {
+				t.Errorf("expected reset at %v; got %v", tc.expectedResetAt, q.ResetAt())
+			}
+
+			at, err := q.admit(createRequest())
+			if !checkError(tc.errMsg, err, t) && !at.Equal(tc.expectedResetAt) {
+				t.Errorf("expected delay until %v; got %v", tc.expectedResetAt, at)
+			}
+
+			now = tc.expectedResetAt
+			if q.Remaining() != 2 {
+				t.Errorf("expected remaining 2 in the next window; got %v", q.Remaining())
+			}
+			now = time.Date(2026, 10, 19, 15, 30, 0, 0, time.UTC)
+		})
+	}
+}
+
+func TestQuotaCost(t *testing.T) {
+	tt := []struct {
+		name              string
+		cost              int64
+		policy            QuotaPolicy
+		expectedRemaining int
+		errMsg            string
+	}{
+		{"Positive TC: bulk request", 3, QuotaReject, 2, ""},
+		{"Positive TC: free request", 0, QuotaReject, 5, ""},
+		{"Negative TC: request bigger than the remaining quota", 6, QuotaReject, 5, "quota exhausted"},
+		{"Negative TC: request bigger than the limit is never delayed", 6, QuotaDelay, 5, "quota exhausted"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			q, err := NewQuota(5, Daily, tc.policy, time.UTC, "")
+			if err != nil {
+				t.Fatalf("unable to create a quota: %v", err)
+			}
+			req := createRequest()
+			req.Cost = tc.cost
+			_, err = q.admit(req)
+			checkError(tc.errMsg, err, t)
+			if q.Remaining() != tc.expectedRemaining {
+				t.Errorf("expected remaining %v; got %v", tc.expectedRemaining, q.Remaining())
+			}
+		})
+	}
+}
+
+func TestQuotaRefund(t *testing.T) {
+	tt := []struct {
+		name              string
+		elapsed           time.Duration
+		counted           bool
+		expectedRemaining int
+	}{
+		{"Positive TC: refund in the same window", time.Hour, true, 1},
+		{"Negative TC: refund of a previous window", 24 * time.Hour, true, 1},
+		{"Negative TC: refund of a request not counted", time.Hour, false, 1},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			now := time.Date(2026, 10, 19, 15, 30, 0, 0, time.UTC)
+			q, _ := NewQuota(2, Daily, QuotaReject, time.UTC, "")
+			q.now = func() time.Time { return now }
+			req := createRequest()
+			if tc.counted {
+				q.admit(req)
+			}
+			now = now.Add(tc.elapsed)
+			q.admit(createRequest())
+			q.refund(req)
+			if q.Remaining() != tc.expectedRemaining {
+				t.Errorf("expected remaining %v; got %v", tc.expectedRemaining, q.Remaining())
+			}
+		})
+	}
+}
+
+func TestQuotaPersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "quota")
+	if err != nil {
+		t.Fatalf("unable to create a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "quota.json")
+
+	tt := []struct {
+		name              string
+		now               time.Time
+		expectedRemaining int
+	}{
+		{"Positive TC: counter restored", time.Date(2026, 10, 19, 15, 30, 0, 0, time.UTC), 1},
+		{"Positive TC: counter of a past window ignored", time.Date(2026, 10, 20, 15, 30, 0, 0, time.UTC), 3},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			os.Remove(path)
+			q := &Quota{limit: 3, period: Daily, location: time.UTC, path: path, now: func() time.Time {
+				return time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+			}}
+			if err := q.load(); err != nil {
+				t.Fatalf("unable to load the quota: %v", err)
+			}
+			for i := 0; i < 2; i++ {
+				if _, err := q.admit(createRequest()); err != nil {
+					t.Fatalf("request %d not admitted: %v", i, err)
+				}
+			}
+
+			restored := &Quota{limit: 3, period: Daily, location: time.UTC, path: path, now: func() time.Time { return tc.now }}
+			if err := restored.load(); err != nil {
+				t.Fatalf("unable to load the quota: %v", err)
+			}
+			if restored.Remaining() != tc.expectedRemaining {
+				t.Errorf("expected remaining %v; got %v", tc.expectedRemaining, restored.Remaining())
+			}
+		})
+	}
+}
+
+// bookingDelayGate makes the requests with the given name wait an hour once
+// they have taken their turn
+type bookingDelayGate struct {
+	delayGate
+}
+
+func (g bookingDelayGate) books() {}
+
+func TestQuotaAbandoned(t *testing.T) {
+	tt := []struct {
+		name  string
+		gates []gate
+	}{
+		{"Positive TC: abandoned while waiting the turn", nil},
+		{"Positive TC: abandoned after the quota is counted", []gate{bookingDelayGate{delayGate{"abandoned"}}}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			q, err := NewQuota(2, Daily, QuotaReject, time.UTC, "")
+			if err != nil {
+				t.Fatalf("unable to create a quota: %v", err)
+			}
+			channel := make(chan *Request, 1)
+			fulfilled := make(chan string, 3)
+			mockFulfiller := &MockFulfiller{
+				fulfillMock: func(req *Request) {
+					fulfilled <- req.Name
+				},
+			}
+			gates := append([]gate{q}, tc.gates...)
+			listener, err := NewListener(&rate{Period: 100 * time.Millisecond}, newLeakyBucket(time.Now()), channel, false, mockFulfiller, gates...)
+			if err != nil {
+				t.Fatalf("unable to create a listener: %v", err)
+			}
+			go listener.listen()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			for _, name := range []string{"first", "abandoned", "last"} {
+				req := createRequest()
+				req.Name = name
+				if name == "abandoned" {
+					req.Ctx = ctx
+				}
+				channel <- req
+				if name == "abandoned" {
+					time.Sleep(50 * time.Millisecond)
+					cancel()
+					continue
+				}
+				select {
+				case got := <-fulfilled:
+					if got != name {
+						t.Fatalf("expected %v to be fulfilled; got %v", name, got)
+					}
+				case res := <-req.ResChan:
+					t.Fatalf("%v not fulfilled: %v", name, res.Err)
+				case <-time.After(5 * time.Second):
+					t.Fatalf("%v not fulfilled", name)
+				}
+			}
+			if q.Remaining() != 0 {
+				t.Errorf("expected remaining 0; got %v", q.Remaining())
+			}
+		})
+	}
+}
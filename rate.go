@@ -12,9 +12,19 @@ type Rate interface {
 	CalculateRate() time.Duration
 }
 
+// exactRate is implemented by the rates whose period is not an integer number
+// of nanoseconds. The period is timeReference / calls, and the listener carries
+// the remainder of the division from one request to the next so the average
+// throughput is exact over long runs.
+type exactRate interface {
+	fraction() (timeReference time.Duration, calls int64, guardTime time.Duration)
+}
+
 type rate struct {
-	Period    time.Duration
-	GuardTime time.Duration
+	Period        time.Duration
+	GuardTime     time.Duration
+	timeReference time.Duration
+	calls         int64
 }
 
 // CalculateRate calculates the request rate as the period + guardTime
@@ -22,6 +32,13 @@ func (r *rate) CalculateRate() time.Duration {
 	return r.Period + r.GuardTime
 }
 
+func (r *rate) fraction() (time.Duration, int64, time.Duration) {
+	if r.calls == 0 {
+		return r.Period, 1, r.GuardTime
+	}
+	return r.timeReference, r.calls, r.GuardTime
+}
+
 // NewRateByCallsPerSecond initializes the Rate based on the maxCallsPerSecond
 func NewRateByCallsPerSecond(maxCallsPerSecond int, guardTime time.Duration) (Rate, error) {
 	return newRate(maxCallsPerSecond, guardTime, time.Second)
@@ -37,6 +54,16 @@ func NewRateByCallsPerHour(maxCallsPerHour int, guardTime time.Duration) (Rate,
 	return newRate(maxCallsPerHour, guardTime, time.Hour)
 }
 
+// NewRateByCallsPerDuration initializes the Rate that allows maxCalls every timeReference,
+// for instance 1 call every 90 seconds or 5 calls every 2 seconds (2.5 calls per second).
+// The period is not truncated: the listener keeps the exact average throughput.
+func NewRateByCallsPerDuration(maxCalls int, timeReference time.Duration, guardTime time.Duration) (Rate, error) {
+	if timeReference <= 0 {
+		return nil, fmt.Errorf("timeReference must be greater than zero")
+	}
+	return newRate(maxCalls, guardTime, timeReference)
+}
+
 func newRate(maxCalls int, guardTime time.Duration, timeReference time.Duration) (Rate, error) {
 	if maxCalls <= 0 {
 		return nil, fmt.Errorf("maxCalls must be greater than zero")
@@ -45,7 +72,9 @@ func newRate(maxCalls int, guardTime time.Duration, timeReference time.Duration)
 		return nil, fmt.Errorf("guardTime must be greater or equal than zero")
 	}
 	return &rate{
-		Period:    timeReference / time.Duration(maxCalls),
-		GuardTime: guardTime,
+		Period:        timeReference / time.Duration(maxCalls),
+		GuardTime:     guardTime,
+		timeReference: timeReference,
+		calls:         int64(maxCalls),
 	}, nil
 }
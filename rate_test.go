@@ -91,6 +91,35 @@ func TestNewRateByCallsPerHour(t *testing.T) {
 	}
 }
 
+func TestNewRateByCallsPerDuration(t *testing.T) {
+	tt := []struct {
+		name                 string
+		maxCalls             int
+		timeReference        time.Duration
+		guardTime            time.Duration
+		expectedRateDuration time.Duration
+		errMsg               string
+	}{
+		{"Positive TC: one call every 90 seconds", 1, 90 * time.Second, 0, 90 * time.Second, ""},
+		{"Positive TC: 2.5 calls per second", 5, 2 * time.Second, duration50ms, 450 * time.Millisecond, ""},
+		{"Negative TC: maxCalls zero", 0, time.Second, 0, 0, "maxCalls must be greater than zero"},
+		{"Negative TC: timeReference zero", 1, 0, 0, 0, "timeReference must be greater than zero"},
+		{"Negative TC: guardTime", 1, time.Second, -duration50ms, 0, "guardTime must be greater or equal than zero"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			rate, err := throttler.NewRateByCallsPerDuration(tc.maxCalls, tc.timeReference, tc.guardTime)
+			if !checkError(tc.errMsg, err, t) {
+				rateDuration := rate.CalculateRate()
+				if rateDuration != tc.expectedRateDuration {
+					t.Errorf("expected rate duration %v; got %v", tc.expectedRateDuration, rateDuration)
+				}
+			}
+		})
+	}
+}
+
 func TestCalculateRate(t *testing.T) {
 	tt := []struct {
 		name              string
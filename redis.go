@@ -0,0 +1,223 @@
+package throttler
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RedisStore is a Store kept in a Redis server (or any server speaking the Redis
+// protocol), so that throttlers running in several processes share the rate.
+// The compare and swap is implemented with an optimistic WATCH/MULTI/EXEC
+// transaction.
+type RedisStore struct {
+	mu       sync.Mutex
+	addr     string
+	password string
+	timeout  time.Duration
+	conn     net.Conn
+	rd       *bufio.Reader
+}
+
+// errRedisNil is returned by do for nil replies
+var errRedisNil = fmt.Errorf("redis: nil")
+
+// NewRedisStore connects to the Redis server listening at addr, authenticating with
+// password if it is not empty. The timeout applies to the connection and every command.
+func NewRedisStore(addr string, password string, timeout time.Duration) (*RedisStore, error) {
+	if addr == "" {
+		return nil, fmt.Errorf("addr can not be empty")
+	}
+	if timeout <= 0 {
+		return nil, fmt.Errorf("timeout must be greater than zero")
+	}
+	s := &RedisStore{addr: addr, password: password, timeout: timeout}
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Get returns the value stored at key, or an empty string if it does not exist.
+func (s *RedisStore) Get(key string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, err := s.do("GET", key)
+	if err == errRedisNil {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return v.(string), nil
+}
+
+// CompareAndSwap stores value at key only if it still holds old.
+func (s *RedisStore) CompareAndSwap(key string, old string, value string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.do("WATCH", key); err != nil {
+		return false, err
+	}
+	current, err := s.do("GET", key)
+	if err == errRedisNil {
+		current, err = "", nil
+	}
+	if err != nil {
+		s.reset("UNWATCH")
+		return false, err
+	}
+	if current.(string) != old {
+		_, err := s.do("UNWATCH")
+		return false, err
+	}
+	if _, err := s.do("MULTI"); err != nil {
+		s.reset("UNWATCH")
+		return false, err
+	}
+	ms := int64(ttl / time.Millisecond)
+	if ms <= 0 {
+		ms = 1
+	}
+	if _, err := s.do("SET", key, value, "PX", strconv.FormatInt(ms, 10)); err != nil {
+		s.reset("DISCARD")
+		return false, err
+	}
+	_, err = s.do("EXEC")
+	if err == errRedisNil {
+		return false, nil // the key changed after WATCH
+	}
+	return err == nil, err
+}
+
+// reset ends the transaction left open by a failed command with cmd, UNWATCH or
+// DISCARD, so the next command does not run inside it. If that is not possible
+// the connection is closed and opened again by the next command.
+func (s *RedisStore) reset(cmd string) {
+	if s.conn == nil {
+		return
+	}
+	if _, err := s.do(cmd); err != nil && s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+}
+
+// Close closes the connection to the server.
+func (s *RedisStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+func (s *RedisStore) connect() error {
+	conn, err := net.DialTimeout("tcp", s.addr, s.timeout)
+	if err != nil {
+		return fmt.Errorf("unable to connect to redis: %v", err)
+	}
+	s.conn = conn
+	s.rd = bufio.NewReader(conn)
+	if s.password != "" {
+		if _, err := s.do("AUTH", s.password); err != nil {
+			s.conn.Close()
+			s.conn = nil
+			return fmt.Errorf("unable to authenticate to redis: %v", err)
+		}
+	}
+	return nil
+}
+
+// do sends a command and reads its reply. The connection is closed on network
+// errors and opened again by the next command.
+func (s *RedisStore) do(args ...string) (interface{}, error) {
+	if s.conn == nil {
+		if err := s.connect(); err != nil {
+			return nil, err
+		}
+	}
+	s.conn.SetDeadline(time.Now().Add(s.timeout))
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(s.conn, b.String()); err != nil {
+		s.conn.Close()
+		s.conn = nil
+		return nil, err
+	}
+	v, err := readRESP(s.rd)
+	if _, ok := err.(redisError); !ok && err != nil && err != errRedisNil {
+		s.conn.Close()
+		s.conn = nil
+	}
+	return v, err
+}
+
+// redisError is an error reply sent by the server
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// readRESP reads a reply of the Redis serialization protocol
+func readRESP(rd *bufio.Reader) (interface{}, error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, fmt.Errorf("redis: empty reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, errRedisNil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(rd, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, errRedisNil
+		}
+		values := make([]interface{}, n)
+		for i := range values {
+			v, err := readRESP(rd)
+			if err != nil && err != errRedisNil {
+				return nil, err
+			}
+			values[i] = v
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("redis: unexpected reply %q", line)
+}
@@ -0,0 +1,281 @@
+package throttler_test
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/centraldereservas/throttler"
+)
+
+// redisServer is an in-memory stand-in of a Redis server which supports the
+// commands used by the RedisStore
+type redisServer struct {
+	mu       sync.Mutex
+	ln       net.Listener
+	password string
+	values   map[string]string
+	expires  map[string]time.Time
+	versions map[string]int
+	failSet  bool
+}
+
+func newRedisServer(t *testing.T, password string) *redisServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	s := &redisServer{
+		ln:       ln,
+		password: password,
+		values:   make(map[string]string),
+		expires:  make(map[string]time.Time),
+		versions: make(map[string]int),
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *redisServer) addr() string {
+	return s.ln.Addr().String()
+}
+
+func (s *redisServer) close() {
+	s.ln.Close()
+}
+
+func (s *redisServer) serve(conn net.Conn) {
+	defer conn.Close()
+	rd := bufio.NewReader(conn)
+	authenticated := s.password == ""
+	var watched map[string]int
+	var queued [][]string
+	multi := false
+	for {
+		args, err := readCommand(rd)
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(args[0])
+		var reply string
+		switch {
+		case cmd == "AUTH":
+			if len(args) == 2 && args[1] == s.password {
+				authenticated = true
+				reply = "+OK\r\n"
+			} else {
+				reply = "-WRONGPASS invalid password\r\n"
+			}
+		case !authenticated:
+			reply = "-NOAUTH Authentication required.\r\n"
+		case cmd == "WATCH":
+			s.mu.Lock()
+			watched = make(map[string]int)
+			for _, key := range args[1:] {
+				s.expire(key)
+				watched[key] = s.versions[key]
+			}
+			s.mu.Unlock()
+			reply = "+OK\r\n"
+		case cmd == "UNWATCH":
+			watched = nil
+			reply = "+OK\r\n"
+		case cmd == "DISCARD":
+			multi, watched, queued = false, nil, nil
+			reply = "+OK\r\n"
+		case cmd == "MULTI":
+			multi = true
+			queued = nil
+			reply = "+OK\r\n"
+		case cmd == "EXEC":
+			s.mu.Lock()
+			conflict := false
+			for key, version := range watched {
+				s.expire(key)
+				if s.versions[key] != version {
+					conflict = true
+				}
+			}
+			if conflict {
+				reply = "*-1\r\n"
+			} else {
+				reply = fmt.Sprintf("*%d\r\n", len(queued))
+				for _, q := range queued {
+					reply += s.exec(q)
+				}
+			}
+			s.mu.Unlock()
+			multi, watched, queued = false, nil, nil
+		case multi && cmd == "SET" && s.failing():
+			reply = "-ERR injected failure\r\n"
+		case multi:
+			queued = append(queued, args)
+			reply = "+QUEUED\r\n"
+		default:
+			s.mu.Lock()
+			reply = s.exec(args)
+			s.mu.Unlock()
+		}
+		if _, err := io.WriteString(conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+// failing reports whether the SET commands of transactions must fail
+func (s *redisServer) failing() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.failSet
+}
+
+// exec runs GET and SET with the mutex held
+func (s *redisServer) exec(args []string) string {
+	switch strings.ToUpper(args[0]) {
+	case "GET":
+		s.expire(args[1])
+		v, ok := s.values[args[1]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(v), v)
+	case "SET":
+		key := args[1]
+		s.values[key] = args[2]
+		s.versions[key]++
+		delete(s.expires, key)
+		if len(args) == 5 && strings.ToUpper(args[3]) == "PX" {
+			ms, _ := strconv.Atoi(args[4])
+			s.expires[key] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+		}
+		return "+OK\r\n"
+	}
+	return "-ERR unknown command\r\n"
+}
+
+func (s *redisServer) expire(key string) {
+	if at, ok := s.expires[key]; ok && !time.Now().Before(at) {
+		delete(s.values, key)
+		delete(s.expires, key)
+		s.versions[key]++
+	}
+}
+
+func readCommand(rd *bufio.Reader) ([]string, error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line)[1:])
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		line, err := rd.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(line)[1:])
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(rd, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func TestNewRedisStore(t *testing.T) {
+	server := newRedisServer(t, "secret")
+	defer server.close()
+
+	tt := []struct {
+		name     string
+		addr     string
+		password string
+		timeout  time.Duration
+		errMsg   string
+	}{
+		{"Positive TC", server.addr(), "secret", time.Second, ""},
+		{"Negative TC: addr empty", "", "", time.Second, "addr can not be empty"},
+		{"Negative TC: timeout zero", server.addr(), "secret", 0, "timeout must be greater than zero"},
+		{"Negative TC: wrong password", server.addr(), "wrong", time.Second, "unable to authenticate to redis: redis: WRONGPASS invalid password"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			store, err := throttler.NewRedisStore(tc.addr, tc.password, tc.timeout)
+			checkError(tc.errMsg, err, t)
+			if store != nil {
+				store.Close()
+			}
+		})
+	}
+}
+
+func TestRedisStore(t *testing.T) {
+	server := newRedisServer(t, "")
+	defer server.close()
+	store, err := throttler.NewRedisStore(server.addr(), "", time.Second)
+	if err != nil {
+		t.Fatalf("unable to connect: %v", err)
+	}
+	defer store.Close()
+	testStore(store, t)
+}
+
+func TestRedisStoreFailedTransaction(t *testing.T) {
+	server := newRedisServer(t, "")
+	defer server.close()
+	store, err := throttler.NewRedisStore(server.addr(), "", time.Second)
+	if err != nil {
+		t.Fatalf("unable to connect: %v", err)
+	}
+	defer store.Close()
+
+	server.mu.Lock()
+	server.failSet = true
+	server.mu.Unlock()
+	_, err = store.CompareAndSwap("key", "", "a", time.Minute)
+	checkError("redis: ERR injected failure", err, t)
+
+	// the next compare and swap does not run inside the failed transaction
+	server.mu.Lock()
+	server.failSet = false
+	server.mu.Unlock()
+	if ok, err := store.CompareAndSwap("key", "", "b", time.Minute); !ok || err != nil {
+		t.Errorf("expected the value to be swapped; got %v, %v", ok, err)
+	}
+	if v, err := store.Get("key"); v != "b" || err != nil {
+		t.Errorf("expected value b; got %q, %v", v, err)
+	}
+}
+
+func TestQueueWithRedisStore(t *testing.T) {
+	server := newRedisServer(t, "")
+	defer server.close()
+	store, err := throttler.NewRedisStore(server.addr(), "", time.Second)
+	if err != nil {
+		t.Fatalf("unable to connect: %v", err)
+	}
+	defer store.Close()
+	testSharedStore(store, t)
+}
@@ -8,9 +8,15 @@ import (
 
 // Request contains the basic structure to be send into the requests channel by Queue function
 type Request struct {
+	// ID identifies the request in Pending and CancelByID
+	ID uint64
+
 	Ctx     context.Context
 	Name    string
 	HReq    *http.Request
 	ResChan chan *Response
 	Timeout time.Duration
+
+	// Cost is the number of calls of the rate consumed by the request, zero for free requests
+	Cost int64
 }
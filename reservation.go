@@ -0,0 +1,80 @@
+package throttler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrReservationDeadline is returned by Reserve when the slot is granted after
+// the deadline of the context.
+var ErrReservationDeadline = errors.New("reservation exceeds the context deadline")
+
+// Reservation holds a slot booked in the throttler schedule with Limiter.Reserve.
+// The caller either waits for it with Commit and sends the requests itself,
+// or gives it back with Cancel.
+type Reservation struct {
+	mu        sync.Mutex
+	ctx       context.Context
+	release   func()
+	at        time.Time
+	done      bool
+	cancelled bool
+}
+
+// Time returns the time when the reservation is granted.
+func (r *Reservation) Time() time.Time {
+	return r.at
+}
+
+// Delay returns how long the caller must wait until the reservation is granted,
+// zero if it is already granted.
+func (r *Reservation) Delay() time.Duration {
+	if d := time.Until(r.Time()); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// Cancel gives the booked slot back to the throttler so that it can be used
+// by other requests. It does nothing if the reservation was already committed.
+func (r *Reservation) Cancel() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.done {
+		return
+	}
+	r.done = true
+	r.cancelled = true
+	r.release()
+}
+
+// Commit blocks until the reservation is granted. If the context is cancelled
+// before, the slot is given back and the context error is returned.
+func (r *Reservation) Commit() error {
+	r.mu.Lock()
+	if r.cancelled {
+		r.mu.Unlock()
+		return fmt.Errorf("reservation cancelled")
+	}
+	r.mu.Unlock()
+
+	timer := time.NewTimer(r.Delay())
+	defer timer.Stop()
+	select {
+	case <-r.ctx.Done():
+		r.Cancel()
+		return r.ctx.Err()
+	case <-timer.C:
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cancelled {
+		return fmt.Errorf("reservation cancelled")
+	}
+	r.done = true
+	return nil
+}
@@ -0,0 +1,216 @@
+package throttler_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/centraldereservas/throttler"
+)
+
+func buildReservationThrottler(t *testing.T, callsPerSecond int) throttler.Limiter {
+	rate, err := throttler.NewRateByCallsPerSecond(callsPerSecond, 0)
+	if err != nil {
+		t.Fatalf("unable to create a rate")
+	}
+	limiter, err := throttler.New(rate, 5, newMockClient(http.StatusOK), false)
+	if err != nil {
+		t.Fatalf("unable to create a throttler: %v", err)
+	}
+	return limiter
+}
+
+func TestReserve(t *testing.T) {
+	cancelledCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+	shortCtx, cancelShort := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancelShort()
+
+	tt := []struct {
+		name          string
+		ctx           context.Context
+		n             int
+		pause         bool
+		expectedDelay time.Duration
+		errMsg        string
+	}{
+		{"Positive TC: one slot", context.Background(), 1, false, 100 * time.Millisecond, ""},
+		{"Positive TC: three units", context.Background(), 3, false, 100 * time.Millisecond, ""},
+		{"Negative TC: n zero", context.Background(), 0, false, 0, "n must be greater than zero"},
+		{"Negative TC: context cancelled", cancelledCtx, 1, false, 0, "context canceled"},
+		{"Negative TC: context deadline before the slot", shortCtx, 1, false, 0, "reservation exceeds the context deadline"},
+		{"Negative TC: paused", context.Background(), 1, true, 0, "throttler is paused"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			limiter := buildReservationThrottler(t, 10)
+			if tc.pause {
+				limiter.Pause()
+			}
+			r, err := limiter.Reserve(tc.ctx, tc.n)
+			if checkError(tc.errMsg, err, t) {
+				return
+			}
+			defer r.Cancel()
+			if d := r.Delay(); d > tc.expectedDelay || d < tc.expectedDelay-50*time.Millisecond {
+				t.Errorf("expected delay around %v; got %v", tc.expectedDelay, d)
+			}
+		})
+	}
+}
+
+func TestReservationCost(t *testing.T) {
+	limiter := buildReservationThrottler(t, 10)
+	bulk, err := limiter.Reserve(context.Background(), 3)
+	if err != nil {
+		t.Fatalf("unable to reserve: %v", err)
+	}
+	defer bulk.Cancel()
+	next, err := limiter.Reserve(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("unable to reserve: %v", err)
+	}
+	defer next.Cancel()
+	if d := next.Time().Sub(bulk.Time()); d != 300*time.Millisecond {
+		t.Errorf("expected the next slot 3 periods after the bulk one; got %v", d)
+	}
+}
+
+func TestReservationCancel(t *testing.T) {
+	limiter := buildReservationThrottler(t, 10)
+	first, err := limiter.Reserve(context.Background(), 2)
+	if err != nil {
+		t.Fatalf("unable to reserve: %v", err)
+	}
+	first.Cancel()
+	if err := first.Commit(); err == nil || err.Error() != "reservation cancelled" {
+		t.Errorf("expected the commit of a cancelled reservation to fail; got %v", err)
+	}
+
+	second, err := limiter.Reserve(context.Background(), 2)
+	if err != nil {
+		t.Fatalf("unable to reserve: %v", err)
+	}
+	defer second.Cancel()
+	if !second.Time().Equal(first.Time()) {
+		t.Errorf("expected the cancelled slots to be reused at %v; got %v", first.Time(), second.Time())
+	}
+}
+
+func TestReservationCommit(t *testing.T) {
+	tt := []struct {
+		name    string
+		timeout time.Duration
+		errMsg  string
+	}{
+		{"Positive TC", 0, ""},
+		{"Negative TC: context cancelled while waiting", 20 * time.Millisecond, "context canceled"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			limiter := buildReservationThrottler(t, 10)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			r, err := limiter.Reserve(ctx, 1)
+			if err != nil {
+				t.Fatalf("unable to reserve: %v", err)
+			}
+			if tc.timeout > 0 {
+				time.AfterFunc(tc.timeout, cancel)
+			}
+			err = r.Commit()
+			if !checkError(tc.errMsg, err, t) {
+				if time.Now().Before(r.Time()) {
+					t.Errorf("commit returned before the reservation time")
+				}
+				r.Cancel()
+				if next, _ := limiter.Reserve(context.Background(), 1); next.Time().Equal(r.Time()) {
+					t.Errorf("a committed reservation can not be cancelled")
+				}
+			}
+		})
+	}
+}
+
+func TestReservationDelaysQueue(t *testing.T) {
+	limiter := buildReservationThrottler(t, 20)
+	limiter.Run()
+	r, err := limiter.Reserve(context.Background(), 3)
+	if err != nil {
+		t.Fatalf("unable to reserve: %v", err)
+	}
+
+	req, _ := http.NewRequest("GET", "http://example.com/", nil)
+	res, err := limiter.Queue(context.Background(), "after reservation", req, duration10s)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	res.Body.Close()
+	if time.Now().Before(r.Time().Add(50 * time.Millisecond)) {
+		t.Errorf("queued request dispatched before the reserved slots")
+	}
+}
+
+func TestReservationQuota(t *testing.T) {
+	quota, _ := throttler.NewQuota(3, throttler.Daily, throttler.QuotaDelay, time.UTC, "")
+	rate, _ := throttler.NewRateByCallsPerSecond(100, 0)
+	limiter, _ := throttler.New(rate, 5, newMockClient(http.StatusOK), false, throttler.WithQuota(quota))
+
+	first, err := limiter.Reserve(context.Background(), 2)
+	if err != nil {
+		t.Fatalf("unable to reserve: %v", err)
+	}
+	if _, err := limiter.Reserve(context.Background(), 2); err != throttler.ErrQuotaExhausted {
+		t.Errorf("expected error %v; got %v", throttler.ErrQuotaExhausted, err)
+	}
+	if quota.Remaining() != 1 {
+		t.Errorf("expected remaining 1; got %v", quota.Remaining())
+	}
+
+	// the cancelled reservation gives its cost back to the quota
+	first.Cancel()
+	if quota.Remaining() != 3 {
+		t.Errorf("expected remaining 3; got %v", quota.Remaining())
+	}
+	second, err := limiter.Reserve(context.Background(), 3)
+	if err != nil {
+		t.Fatalf("unable to reserve: %v", err)
+	}
+	if err := second.Commit(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestReservationStore(t *testing.T) {
+	store := throttler.NewMemoryStore()
+	var slots []time.Time
+	for i := 0; i < 2; i++ {
+		rate, _ := throttler.NewRateByCallsPerSecond(10, 0)
+		limiter, _ := throttler.New(rate, 5, newMockClient(http.StatusOK), false, throttler.WithStore(store, "provider"))
+		r, err := limiter.Reserve(context.Background(), 1)
+		if err != nil {
+			t.Fatalf("unable to reserve: %v", err)
+		}
+		defer r.Cancel()
+		slots = append(slots, r.Time())
+	}
+
+	// the throttlers sharing the store do not grant their reservations together
+	if d := slots[1].Sub(slots[0]); d < 90*time.Millisecond {
+		t.Errorf("expected the reservations spaced by the shared rate; got %v", d)
+	}
+}
+
+func TestReservationBreaker(t *testing.T) {
+	breaker, _ := throttler.NewBreaker(1, 1, time.Minute, time.Minute)
+	rate, _ := throttler.NewRateByCallsPerSecond(100, 0)
+	limiter, _ := throttler.New(rate, 5, newMockClient(http.StatusBadGateway), false, throttler.WithBreaker(breaker))
+	limiter.Run()
+	queueStatus(limiter)
+	if _, err := limiter.Reserve(context.Background(), 1); err != throttler.ErrBreakerOpen {
+		t.Errorf("expected error %v; got %v", throttler.ErrBreakerOpen, err)
+	}
+}
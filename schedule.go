@@ -0,0 +1,164 @@
+package throttler
+
+import (
+	"fmt"
+	"time"
+)
+
+// ScheduleRule selects the Rate to be used during a daily time window.
+type ScheduleRule struct {
+	// Days are the weekdays where the rule applies; every day if empty
+	Days []time.Weekday
+
+	// Start and End are offsets from midnight delimiting the window [Start, End).
+	// If End is not after Start the window spans midnight.
+	Start time.Duration
+	End   time.Duration
+
+	// Location is the time zone used to evaluate the window; time.Local if nil
+	Location *time.Location
+
+	// Rate is the rate applied inside the window
+	Rate Rate
+}
+
+type scheduledRate struct {
+	rules    []ScheduleRule
+	fallback Rate
+	now      func() time.Time
+}
+
+// NewScheduledRate initializes a Rate that changes depending on the time of the day and the
+// weekday. The first matching rule is applied and fallback is used outside of every window.
+//
+// For instance "Mon-Fri 08:00-20:00 Europe/Madrid: 5/s, otherwise 20/s" is expressed as:
+//
+//	madrid, _ := time.LoadLocation("Europe/Madrid")
+//	day, _ := throttler.NewRateByCallsPerSecond(5, 0)
+//	otherwise, _ := throttler.NewRateByCallsPerSecond(20, 0)
+//	rate, err := throttler.NewScheduledRate(otherwise, throttler.ScheduleRule{
+//		Days:     []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+//		Start:    8 * time.Hour,
+//		End:      20 * time.Hour,
+//		Location: madrid,
+//		Rate:     day,
+//	})
+func NewScheduledRate(fallback Rate, rules ...ScheduleRule) (Rate, error) {
+	if fallback == nil {
+		return nil, fmt.Errorf("fallback rate can not be nil")
+	}
+	for _, rule := range rules {
+		if rule.Rate == nil {
+			return nil, fmt.Errorf("rule rate can not be nil")
+		}
+		if rule.Start < 0 || rule.Start > 24*time.Hour || rule.End < 0 || rule.End > 24*time.Hour {
+			return nil, fmt.Errorf("rule window must be between 0 and 24h")
+		}
+	}
+	return &scheduledRate{
+		rules:    rules,
+		fallback: fallback,
+		now:      time.Now,
+	}, nil
+}
+
+// CalculateRate calculates the rate of the rule matching the current time
+func (s *scheduledRate) CalculateRate() time.Duration {
+	return s.current(s.now()).CalculateRate()
+}
+
+func (s *scheduledRate) fraction() (time.Duration, int64, time.Duration) {
+	current := s.current(s.now())
+	if e, ok := current.(exactRate); ok {
+		return e.fraction()
+	}
+	return current.CalculateRate(), 1, 0
+}
+
+func (s *scheduledRate) current(now time.Time) Rate {
+	for _, rule := range s.rules {
+		if rule.matches(now) {
+			return rule.Rate
+		}
+	}
+	return s.fallback
+}
+
+// observe reports the response to the rate of the rule matching the time when
+// the request was sent, if it adapts to the responses
+func (s *scheduledRate) observe(sent time.Time, res *Response) {
+	if a, ok := s.current(sent).(adaptiveRate); ok {
+		a.observe(sent, res)
+	}
+}
+
+// nextChange returns the next time after now where a rule window starts or
+// ends, so the listener can calculate the rate again at that moment
+func (s *scheduledRate) nextChange() time.Time {
+	now := s.now()
+	var next time.Time
+	for _, rule := range s.rules {
+		for _, offset := range []time.Duration{rule.Start, rule.End} {
+			t := rule.nextClock(now, offset)
+			if next.IsZero() || t.Before(next) {
+				next = t
+			}
+		}
+	}
+	return next
+}
+
+func (r ScheduleRule) location() *time.Location {
+	if r.Location == nil {
+		return time.Local
+	}
+	return r.Location
+}
+
+func (r ScheduleRule) matches(t time.Time) bool {
+	t = t.In(r.location())
+	clock := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second + time.Duration(t.Nanosecond())
+	if r.Start < r.End {
+		return clock >= r.Start && clock < r.End && r.appliesOn(t.Weekday())
+	}
+	// the window spans midnight, the early part belongs to the previous day
+	if clock >= r.Start {
+		return r.appliesOn(t.Weekday())
+	}
+	return clock < r.End && r.appliesOn((t.Weekday()+6)%7)
+}
+
+func (r ScheduleRule) appliesOn(day time.Weekday) bool {
+	if len(r.Days) == 0 {
+		return true
+	}
+	for _, d := range r.Days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// nextClock returns the first time after t where the clock of the rule
+// location shows the given offset from midnight
+func (r ScheduleRule) nextClock(t time.Time, offset time.Duration) time.Time {
+	t = t.In(r.location())
+	next := clockOn(t, 0, offset)
+	if !next.After(t) {
+		next = clockOn(t, 1, offset)
+	}
+	return next
+}
+
+// clockOn returns the time when the clock shows the given offset from midnight,
+// days after the day of t. The time is built from the clock components, so the
+// days when daylight saving time starts or ends are not shifted by an hour.
+func clockOn(t time.Time, days int, offset time.Duration) time.Time {
+	h := offset / time.Hour
+	m := offset % time.Hour / time.Minute
+	s := offset % time.Minute / time.Second
+	ns := offset % time.Second
+	return time.Date(t.Year(), t.Month(), t.Day()+days, int(h), int(m), int(s), int(ns), t.Location())
+}
@@ -0,0 +1,141 @@
+package throttler_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/centraldereservas/throttler"
+)
+
+func TestNewScheduledRate(t *testing.T) {
+	day, _ := throttler.NewRateByCallsPerSecond(2, 0)
+	night, _ := throttler.NewRateByCallsPerSecond(10, 0)
+	tt := []struct {
+		name     string
+		fallback throttler.Rate
+		rule     throttler.ScheduleRule
+		errMsg   string
+	}{
+		{"Positive TC", night, throttler.ScheduleRule{Start: 8 * time.Hour, End: 20 * time.Hour, Rate: day}, ""},
+		{"Negative TC: fallback nil", nil, throttler.ScheduleRule{Start: 8 * time.Hour, End: 20 * time.Hour, Rate: day}, "fallback rate can not be nil"},
+		{"Negative TC: rule rate nil", night, throttler.ScheduleRule{Start: 8 * time.Hour, End: 20 * time.Hour}, "rule rate can not be nil"},
+		{"Negative TC: negative start", night, throttler.ScheduleRule{Start: -time.Hour, End: 20 * time.Hour, Rate: day}, "rule window must be between 0 and 24h"},
+		{"Negative TC: end after 24h", night, throttler.ScheduleRule{Start: 8 * time.Hour, End: 25 * time.Hour, Rate: day}, "rule window must be between 0 and 24h"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			rate, err := throttler.NewScheduledRate(tc.fallback, tc.rule)
+			if !checkError(tc.errMsg, err, t) && rate == nil {
+				t.Errorf("expected a rate")
+			}
+		})
+	}
+}
+
+func TestScheduledRateCalculateRate(t *testing.T) {
+	madrid := time.FixedZone("CEST", 2*60*60)
+	weekdays := []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}
+	day, _ := throttler.NewRateByCallsPerSecond(5, 0)
+	night, _ := throttler.NewRateByCallsPerSecond(10, 0)
+	otherwise, _ := throttler.NewRateByCallsPerSecond(20, 0)
+	rate, err := throttler.NewScheduledRate(otherwise,
+		throttler.ScheduleRule{Days: weekdays, Start: 8 * time.Hour, End: 20 * time.Hour, Location: madrid, Rate: day},
+		throttler.ScheduleRule{Days: []time.Weekday{time.Friday}, Start: 22 * time.Hour, End: 2 * time.Hour, Location: madrid, Rate: night},
+	)
+	if err != nil {
+		t.Fatalf("unable to create a scheduled rate: %v", err)
+	}
+
+	tt := []struct {
+		name         string
+		now          time.Time
+		expectedRate time.Duration
+	}{
+		{"Positive TC: weekday inside the window", time.Date(2026, 10, 19, 9, 0, 0, 0, madrid), 200 * time.Millisecond},
+		{"Positive TC: weekday in another time zone", time.Date(2026, 10, 19, 6, 30, 0, 0, time.UTC), 200 * time.Millisecond},
+		{"Positive TC: window end is excluded", time.Date(2026, 10, 19, 20, 0, 0, 0, madrid), 50 * time.Millisecond},
+		{"Positive TC: weekday before the window", time.Date(2026, 10, 19, 7, 59, 0, 0, madrid), 50 * time.Millisecond},
+		{"Positive TC: weekend", time.Date(2026, 10, 18, 9, 0, 0, 0, madrid), 50 * time.Millisecond},
+		{"Positive TC: window spanning midnight before midnight", time.Date(2026, 10, 23, 23, 0, 0, 0, madrid), 100 * time.Millisecond},
+		{"Positive TC: window spanning midnight after midnight", time.Date(2026, 10, 24, 1, 0, 0, 0, madrid), 100 * time.Millisecond},
+		{"Positive TC: window spanning midnight on another day", time.Date(2026, 10, 25, 1, 0, 0, 0, madrid), 50 * time.Millisecond},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			throttler.SetScheduleClock(rate, func() time.Time { return tc.now })
+			rateDuration := rate.CalculateRate()
+			if rateDuration != tc.expectedRate {
+				t.Errorf("expected rate duration %v; got %v", tc.expectedRate, rateDuration)
+			}
+		})
+	}
+}
+
+func TestScheduledRateNextChangeDST(t *testing.T) {
+	madrid, err := time.LoadLocation("Europe/Madrid")
+	if err != nil {
+		t.Skipf("time zone database not available: %v", err)
+	}
+	day, _ := throttler.NewRateByCallsPerSecond(5, 0)
+	otherwise, _ := throttler.NewRateByCallsPerSecond(20, 0)
+	rate, err := throttler.NewScheduledRate(otherwise,
+		throttler.ScheduleRule{Start: 8 * time.Hour, End: 20 * time.Hour, Location: madrid, Rate: day},
+	)
+	if err != nil {
+		t.Fatalf("unable to create a scheduled rate: %v", err)
+	}
+
+	tt := []struct {
+		name     string
+		now      time.Time
+		expected time.Time
+	}{
+		{"Positive TC: daylight saving time starts", time.Date(2024, 3, 31, 1, 0, 0, 0, madrid), time.Date(2024, 3, 31, 6, 0, 0, 0, time.UTC)},
+		{"Positive TC: daylight saving time ends", time.Date(2024, 10, 27, 1, 0, 0, 0, madrid), time.Date(2024, 10, 27, 7, 0, 0, 0, time.UTC)},
+		{"Positive TC: end of the window after the change", time.Date(2024, 10, 27, 9, 0, 0, 0, madrid), time.Date(2024, 10, 27, 19, 0, 0, 0, time.UTC)},
+		{"Positive TC: next day after the change", time.Date(2024, 3, 30, 21, 0, 0, 0, madrid), time.Date(2024, 3, 31, 6, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			throttler.SetScheduleClock(rate, func() time.Time { return tc.now })
+			next := throttler.NextScheduleChange(rate)
+			if !next.Equal(tc.expected) {
+				t.Errorf("expected next change %v; got %v", tc.expected, next.UTC())
+			}
+		})
+	}
+}
+
+func TestScheduledRateNextChange(t *testing.T) {
+	day, _ := throttler.NewRateByCallsPerSecond(5, 0)
+	otherwise, _ := throttler.NewRateByCallsPerSecond(20, 0)
+	rate, err := throttler.NewScheduledRate(otherwise,
+		throttler.ScheduleRule{Start: 8 * time.Hour, End: 20 * time.Hour, Location: time.UTC, Rate: day},
+	)
+	if err != nil {
+		t.Fatalf("unable to create a scheduled rate: %v", err)
+	}
+
+	tt := []struct {
+		name     string
+		now      time.Time
+		expected time.Time
+	}{
+		{"Positive TC: before the window", time.Date(2026, 10, 19, 7, 0, 0, 0, time.UTC), time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC)},
+		{"Positive TC: inside the window", time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC), time.Date(2026, 10, 19, 20, 0, 0, 0, time.UTC)},
+		{"Positive TC: after the window", time.Date(2026, 10, 19, 21, 0, 0, 0, time.UTC), time.Date(2026, 10, 20, 8, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			throttler.SetScheduleClock(rate, func() time.Time { return tc.now })
+			next := throttler.NextScheduleChange(rate)
+			if !next.Equal(tc.expected) {
+				t.Errorf("expected next change %v; got %v", tc.expected, next)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package throttler
+
+import (
+	"fmt"
+	"time"
+)
+
+// Strategy is the algorithm used by the listener to decide when the queued
+// requests are dispatched. All of them are configured with the same Rate.
+type Strategy int
+
+const (
+	// LeakyBucket dispatches the requests evenly spaced by the rate period
+	LeakyBucket Strategy = iota
+	// SlidingWindowLog allows bursts as long as no rolling window contains more calls than
+	// the rate allows, remembering the time of every call in the window
+	SlidingWindowLog
+	// SlidingWindowCounter is like SlidingWindowLog but only keeps a counter per tenth of
+	// the window, which is slightly more conservative and uses constant memory
+	SlidingWindowCounter
+	// GCRA uses the generic cell rate algorithm, which allows bursts of the size set with
+	// WithBurst and keeps a single timestamp as state
+	GCRA
+)
+
+// limit is the rate expressed as calls per timeReference plus the guard time
+type limit struct {
+	timeReference time.Duration
+	calls         int64
+	guardTime     time.Duration
+}
+
+// scheduler decides when the requests can be dispatched. Every request consumes
+// cost units of the rate, where a unit is one call. It is not safe for
+// concurrent use, the listener serializes the calls.
+type scheduler interface {
+	// next returns the first time at or after now when a request can be dispatched
+	next(now time.Time, lim limit, cost int64) time.Time
+
+	// commit records a request dispatched at the given time
+	commit(at time.Time, lim limit, cost int64)
+
+	// release gives back a slot committed at the given time that was not used.
+	// It is best effort, the slot may be lost if later slots were committed.
+	release(at time.Time, lim limit, cost int64)
+}
+
+func newScheduler(s Strategy, burst int) (scheduler, error) {
+	if burst <= 0 {
+		return nil, fmt.Errorf("burst must be greater than zero")
+	}
+	switch s {
+	case LeakyBucket:
+		return newLeakyBucket(time.Now()), nil
+	case SlidingWindowLog:
+		return &slidingWindowLog{}, nil
+	case SlidingWindowCounter:
+		return &slidingWindowCounter{}, nil
+	case GCRA:
+		return &gcraScheduler{burst: int64(burst)}, nil
+	}
+	return nil, fmt.Errorf("unknown strategy")
+}
+
+// limitOf returns the limit of a rate, which is one call per CalculateRate
+// for the rates that do not implement exactRate
+func limitOf(r Rate) limit {
+	if e, ok := r.(exactRate); ok {
+		timeReference, calls, guardTime := e.fraction()
+		return limit{timeReference: timeReference, calls: calls, guardTime: guardTime}
+	}
+	return limit{timeReference: r.CalculateRate(), calls: 1}
+}
+
+// window returns the length of the rolling window used by the sliding window
+// strategies, which is widened by the guard time
+func (lim limit) window() time.Duration {
+	return lim.timeReference + lim.guardTime
+}
+
+type leakyBucket struct {
+	last  time.Time
+	cost  int64
+	carry int64
+}
+
+// newLeakyBucket initializes the leaky bucket as if a request was dispatched
+// at start, so the first request waits one period
+func newLeakyBucket(start time.Time) scheduler {
+	return &leakyBucket{last: start, cost: 1}
+}
+
+// next returns the time of the last dispatch plus one period per unit of its
+// cost. The remainder of the period division is carried to the next request,
+// so the average throughput is exact.
+func (b *leakyBucket) next(now time.Time, lim limit, cost int64) time.Time {
+	n := b.cost*int64(lim.timeReference) + b.carry
+	due := b.last.Add(time.Duration(n/lim.calls) + time.Duration(b.cost)*lim.guardTime)
+	if due.Before(now) {
+		return now
+	}
+	return due
+}
+
+func (b *leakyBucket) commit(at time.Time, lim limit, cost int64) {
+	b.carry = (b.cost*int64(lim.timeReference) + b.carry) % lim.calls
+	b.last = at
+	b.cost = cost
+}
+
+// release frees the slot if it is the last one, so the next request can be
+// dispatched at its time
+func (b *leakyBucket) release(at time.Time, lim limit, cost int64) {
+	if b.last.Equal(at) {
+		b.cost = 0
+	}
+}
@@ -0,0 +1,269 @@
+package throttler
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestNewScheduler(t *testing.T) {
+	tt := []struct {
+		name     string
+		strategy Strategy
+		errMsg   string
+	}{
+		{"Positive TC: leaky bucket", LeakyBucket, ""},
+		{"Positive TC: sliding window log", SlidingWindowLog, ""},
+		{"Positive TC: sliding window counter", SlidingWindowCounter, ""},
+		{"Positive TC: gcra", GCRA, ""},
+		{"Negative TC: unknown strategy", Strategy(99), "unknown strategy"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			s, err := newScheduler(tc.strategy, 1)
+			if !checkError(tc.errMsg, err, t) && s == nil {
+				t.Errorf("expected a scheduler")
+			}
+		})
+	}
+}
+
+func TestLeakyBucketCarry(t *testing.T) {
+	tt := []struct {
+		name          string
+		maxCalls      int
+		timeReference time.Duration
+		guardTime     time.Duration
+	}{
+		{"Positive TC: 3 calls per second", 3, time.Second, 0},
+		{"Positive TC: 150 calls per 10 seconds", 150, 10 * time.Second, 0},
+		{"Positive TC: 7 calls per 1001 nanoseconds with guard time", 7, 1001, 5},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := NewRateByCallsPerDuration(tc.maxCalls, tc.timeReference, tc.guardTime)
+			if err != nil {
+				t.Fatalf("unable to create a rate: %v", err)
+			}
+			lim := limitOf(r)
+			start := time.Unix(0, 0)
+			s := newLeakyBucket(start)
+
+			// after a whole number of periods the total time must be exact
+			at := start
+			for i := 0; i < 10*tc.maxCalls; i++ {
+				at = s.next(at, lim, 1)
+				s.commit(at, lim, 1)
+			}
+			expected := 10*tc.timeReference + time.Duration(10*tc.maxCalls)*tc.guardTime
+			if total := at.Sub(start); total != expected {
+				t.Errorf("expected total duration %v; got %v", expected, total)
+			}
+		})
+	}
+}
+
+// simulate dispatches bursty random arrivals with costs up to maxCost through
+// the scheduler using a virtual clock and returns the dispatch time of every unit
+func simulate(s scheduler, lim limit, requests int, maxCost int64, seed int64) []time.Time {
+	rnd := rand.New(rand.NewSource(seed))
+	now := time.Unix(1000, 0)
+	dispatched := make([]time.Time, 0, requests)
+	for i := 0; i < requests; i++ {
+		// bursts of simultaneous requests separated by random pauses
+		if rnd.Intn(4) == 0 {
+			now = now.Add(time.Duration(rnd.Int63n(int64(lim.window()))))
+		}
+		cost := rnd.Int63n(maxCost + 1)
+		at := s.next(now, lim, cost)
+		if at.Before(now) {
+			return nil
+		}
+		s.commit(at, lim, cost)
+		for j := int64(0); j < cost; j++ {
+			dispatched = append(dispatched, at)
+		}
+		now = at
+	}
+	return dispatched
+}
+
+func TestSlidingWindowsNeverExceedLimit(t *testing.T) {
+	tt := []struct {
+		name     string
+		strategy Strategy
+		lim      limit
+		burst    int
+		maxCost  int64
+	}{
+		{"Positive TC: log 10 calls per minute", SlidingWindowLog, limit{timeReference: time.Minute, calls: 10}, 1, 1},
+		{"Positive TC: log 7 calls per second with guard time", SlidingWindowLog, limit{timeReference: time.Second, calls: 7, guardTime: 50 * time.Millisecond}, 1, 1},
+		{"Positive TC: log with weighted costs", SlidingWindowLog, limit{timeReference: time.Minute, calls: 10}, 1, 4},
+		{"Positive TC: counter 10 calls per minute", SlidingWindowCounter, limit{timeReference: time.Minute, calls: 10}, 1, 1},
+		{"Positive TC: counter 7 calls per 999 nanoseconds", SlidingWindowCounter, limit{timeReference: 999, calls: 7}, 1, 1},
+		{"Positive TC: counter 1 call per second", SlidingWindowCounter, limit{timeReference: time.Second, calls: 1}, 1, 1},
+		{"Positive TC: counter with weighted costs", SlidingWindowCounter, limit{timeReference: time.Minute, calls: 10}, 1, 4},
+		{"Positive TC: gcra 10 calls per minute", GCRA, limit{timeReference: time.Minute, calls: 10}, 1, 1},
+		{"Positive TC: gcra 7 calls per 999 nanoseconds", GCRA, limit{timeReference: 999, calls: 7}, 1, 1},
+		{"Positive TC: gcra with weighted costs", GCRA, limit{timeReference: time.Minute, calls: 10}, 4, 4},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			for seed := int64(0); seed < 20; seed++ {
+				s, err := newScheduler(tc.strategy, tc.burst)
+				if err != nil {
+					t.Fatalf("unable to create a scheduler: %v", err)
+				}
+				dispatched := simulate(s, tc.lim, 500, tc.maxCost, seed)
+				if dispatched == nil {
+					t.Fatalf("scheduler returned a time before now")
+				}
+
+				// the unit i and the unit i+calls can never be inside the same window (t-window, t],
+				// except for the burst allowed on top of the limit
+				calls := int(tc.lim.calls) + tc.burst - 1
+				for i := 0; i+calls < len(dispatched); i++ {
+					if d := dispatched[i+calls].Sub(dispatched[i]); d < tc.lim.window() {
+						t.Fatalf("seed %d: %d calls in %v, window %v", seed, calls+1, d, tc.lim.window())
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestGCRAWeightedSpacing(t *testing.T) {
+	lim := limit{timeReference: time.Minute, calls: 10}
+	s, err := newScheduler(GCRA, 4)
+	if err != nil {
+		t.Fatalf("unable to create a scheduler: %v", err)
+	}
+
+	// saturated by requests of different costs, the request k is dispatched when
+	// the units before it and its own cost exceed the burst by n, n emission
+	// intervals after the start
+	start := time.Unix(1000, 0)
+	now := start
+	sent := int64(0)
+	for _, cost := range []int64{4, 1, 3, 2, 4, 0, 1, 4} {
+		at := s.next(now, lim, cost)
+		n := sent + cost - 4
+		if n < 0 {
+			n = 0
+		}
+		if expected := start.Add(time.Duration(n) * lim.emission()); !at.Equal(expected) {
+			t.Errorf("expected request of cost %d after %d units at %v; got %v", cost, sent, expected.Sub(start), at.Sub(start))
+		}
+		s.commit(at, lim, cost)
+		sent += cost
+		now = at
+	}
+}
+
+func TestSlidingWindowsAllowBursts(t *testing.T) {
+	tt := []struct {
+		name     string
+		strategy Strategy
+		burst    int
+	}{
+		{"Positive TC: leaky bucket does not burst", LeakyBucket, 1},
+		{"Positive TC: log bursts the whole limit", SlidingWindowLog, 10},
+		{"Positive TC: counter bursts the whole limit", SlidingWindowCounter, 10},
+		{"Positive TC: gcra without burst", GCRA, 1},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			lim := limit{timeReference: time.Minute, calls: 10}
+			s, err := newScheduler(tc.strategy, 1)
+			if err != nil {
+				t.Fatalf("unable to create a scheduler: %v", err)
+			}
+			now := time.Now().Add(time.Hour)
+			burst := 0
+			for s.next(now, lim, 1).Equal(now) && burst < 20 {
+				s.commit(now, lim, 1)
+				burst++
+			}
+			if burst != tc.burst {
+				t.Errorf("expected a burst of %d calls; got %d", tc.burst, burst)
+			}
+		})
+	}
+}
+
+func TestSchedulerRelease(t *testing.T) {
+	tt := []struct {
+		name     string
+		strategy Strategy
+	}{
+		{"Positive TC: leaky bucket", LeakyBucket},
+		{"Positive TC: sliding window log", SlidingWindowLog},
+		{"Positive TC: sliding window counter", SlidingWindowCounter},
+		{"Positive TC: gcra", GCRA},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			lim := limit{timeReference: time.Second, calls: 2}
+			s, err := newScheduler(tc.strategy, 1)
+			if err != nil {
+				t.Fatalf("unable to create a scheduler: %v", err)
+			}
+			now := time.Now().Add(time.Hour)
+			for i := 0; i < 2; i++ {
+				s.commit(s.next(now, lim, 1), lim, 1)
+			}
+
+			before := s.next(now, lim, 2)
+			s.commit(before, lim, 2)
+			s.release(before, lim, 2)
+			if after := s.next(now, lim, 2); !after.Equal(before) {
+				t.Errorf("expected the released slot %v; got %v", before, after)
+			}
+		})
+	}
+}
+
+func TestSchedulerCost(t *testing.T) {
+	tt := []struct {
+		name          string
+		strategy      Strategy
+		firstCost     int64
+		expectedDelay time.Duration
+	}{
+		{"Positive TC: leaky bucket waits one period per unit", LeakyBucket, 3, 3 * time.Second},
+		{"Positive TC: leaky bucket free request", LeakyBucket, 0, 0},
+		{"Positive TC: sliding window log", SlidingWindowLog, 3, 10 * time.Second},
+		{"Positive TC: sliding window log free request", SlidingWindowLog, 0, 0},
+		{"Positive TC: sliding window counter", SlidingWindowCounter, 3, 11 * time.Second},
+		{"Positive TC: gcra waits one period per unit", GCRA, 3, 3 * time.Second},
+		{"Positive TC: gcra free request", GCRA, 0, 0},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			// 3 calls every 3 seconds (plus 7 seconds of guard time for the windows)
+			lim := limit{timeReference: 3 * time.Second, calls: 3}
+			if tc.strategy == SlidingWindowLog || tc.strategy == SlidingWindowCounter {
+				lim.guardTime = 7 * time.Second
+			}
+			s, err := newScheduler(tc.strategy, 1)
+			if err != nil {
+				t.Fatalf("unable to create a scheduler: %v", err)
+			}
+			now := time.Unix(1000, 0)
+			if tc.strategy == LeakyBucket {
+				s = newLeakyBucket(now.Add(-time.Hour))
+			}
+			first := s.next(now, lim, tc.firstCost)
+			s.commit(first, lim, tc.firstCost)
+			if second := s.next(now, lim, 1); second.Sub(first) != tc.expectedDelay {
+				t.Errorf("expected delay %v; got %v", tc.expectedDelay, second.Sub(first))
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package throttler
+
+import "time"
+
+// slidingWindowLog remembers the dispatch time of every unit inside the
+// rolling window, so it allows up to the rate calls in any window
+type slidingWindowLog struct {
+	log []time.Time
+}
+
+func (s *slidingWindowLog) next(now time.Time, lim limit, cost int64) time.Time {
+	window := lim.window()
+	s.expire(now, window)
+	at := now
+	n := int64(len(s.log))
+	if n > 0 && s.log[n-1].After(at) {
+		at = s.log[n-1]
+	}
+	if n+cost <= lim.calls {
+		return at
+	}
+	// the units that keep the window full must leave it; a request costing
+	// more than the limit waits for the window to be empty
+	i := n - lim.calls + cost - 1
+	if i > n-1 {
+		i = n - 1
+	}
+	if leave := s.log[i].Add(window); leave.After(at) {
+		return leave
+	}
+	return at
+}
+
+func (s *slidingWindowLog) commit(at time.Time, lim limit, cost int64) {
+	for i := int64(0); i < cost; i++ {
+		s.log = append(s.log, at)
+	}
+}
+
+func (s *slidingWindowLog) release(at time.Time, lim limit, cost int64) {
+	for i := len(s.log) - 1; i >= 0 && cost > 0; i-- {
+		if s.log[i].Equal(at) {
+			s.log = append(s.log[:i], s.log[i+1:]...)
+			cost--
+		}
+	}
+}
+
+// expire removes the calls that can not be in any window containing now
+func (s *slidingWindowLog) expire(now time.Time, window time.Duration) {
+	i := 0
+	for i < len(s.log) && !s.log[i].After(now.Add(-window)) {
+		i++
+	}
+	s.log = s.log[i:]
+}
+
+// slidingWindowBuckets is the number of counters per window used by slidingWindowCounter
+const slidingWindowBuckets = 10
+
+type bucket struct {
+	index int64
+	count int64
+}
+
+// slidingWindowCounter counts the units per bucket of a tenth of the window.
+// Before dispatching it adds the counters of the current bucket and the ten
+// previous ones, which cover any window that contains the dispatch time.
+type slidingWindowCounter struct {
+	buckets []bucket
+	size    int64
+	last    time.Time
+}
+
+func (s *slidingWindowCounter) next(now time.Time, lim limit, cost int64) time.Time {
+	size := s.bucketSize(lim)
+	if size != s.size {
+		// the counters of another window length can not be compared
+		s.buckets = nil
+		s.size = size
+	}
+	at := now
+	if s.last.After(at) {
+		at = s.last
+	}
+	s.expire(at.UnixNano()/size - slidingWindowBuckets)
+
+	k := at.UnixNano() / size
+	for {
+		var sum int64
+		oldest := int64(-1)
+		for _, b := range s.buckets {
+			if b.index >= k-slidingWindowBuckets && b.index <= k {
+				if oldest < 0 {
+					oldest = b.index
+				}
+				sum += b.count
+			}
+		}
+		// a request costing more than the limit waits for the window to be empty
+		if sum+cost <= lim.calls || oldest < 0 {
+			break
+		}
+		// wait until the oldest counted bucket leaves the window
+		k = oldest + slidingWindowBuckets + 1
+	}
+	if start := time.Unix(0, k*size); start.After(at) {
+		return start
+	}
+	return at
+}
+
+func (s *slidingWindowCounter) commit(at time.Time, lim limit, cost int64) {
+	if cost == 0 {
+		return
+	}
+	k := at.UnixNano() / s.bucketSize(lim)
+	if n := len(s.buckets); n > 0 && s.buckets[n-1].index == k {
+		s.buckets[n-1].count += cost
+	} else {
+		s.buckets = append(s.buckets, bucket{index: k, count: cost})
+	}
+	if at.After(s.last) {
+		s.last = at
+	}
+}
+
+func (s *slidingWindowCounter) release(at time.Time, lim limit, cost int64) {
+	k := at.UnixNano() / s.bucketSize(lim)
+	for i := range s.buckets {
+		if s.buckets[i].index == k {
+			s.buckets[i].count -= cost
+			if s.buckets[i].count < 0 {
+				s.buckets[i].count = 0
+			}
+			return
+		}
+	}
+}
+
+// bucketSize returns the length of a bucket in nanoseconds, rounded up so that
+// the buckets always cover the whole window
+func (s *slidingWindowCounter) bucketSize(lim limit) int64 {
+	window := int64(lim.window())
+	size := (window + slidingWindowBuckets - 1) / slidingWindowBuckets
+	if size == 0 {
+		size = 1
+	}
+	return size
+}
+
+// expire removes the buckets older than index
+func (s *slidingWindowCounter) expire(index int64) {
+	i := 0
+	for i < len(s.buckets) && s.buckets[i].index < index {
+		i++
+	}
+	s.buckets = s.buckets[i:]
+}
@@ -0,0 +1,27 @@
+package throttler
+
+import "time"
+
+// State contains a snapshot of the throttler status returned by Limiter.State.
+type State struct {
+	// Rate is the minimal time.Duration between sending two requests
+	Rate time.Duration
+
+	// Paused is true while the listener does not dispatch requests
+	Paused bool
+
+	// PausedUntil is the time when the pause expires, zero if the pause has no deadline
+	PausedUntil time.Time
+
+	// QueueLength is the number of requests waiting in the requests channel
+	QueueLength int
+
+	// QueueCapacity is the capacity of the requests channel
+	QueueCapacity int
+
+	// InFlight is the number of requests sent which are waiting for their response
+	InFlight int
+
+	// Breaker is the state of the circuit breaker, always closed without WithBreaker
+	Breaker BreakerState
+}
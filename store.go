@@ -0,0 +1,241 @@
+package throttler
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// storeRetries is the number of times a conflicting update of the store is retried
+const storeRetries = 100
+
+// Store keeps rate state shared by several throttlers, usually running in
+// different processes, as strings identified by a key.
+type Store interface {
+	// Get returns the value stored at key, or an empty string if it does not exist
+	Get(key string) (string, error)
+
+	// CompareAndSwap stores value at key only if it still holds old (an empty string
+	// meaning that it does not exist), and reports whether it did. The key expires
+	// after ttl.
+	CompareAndSwap(key string, old string, value string, ttl time.Duration) (bool, error)
+}
+
+// MemoryStore is a Store kept in memory, which can be shared by the throttlers of
+// a single process and is useful for testing.
+type MemoryStore struct {
+	mu     sync.Mutex
+	values map[string]memoryValue
+	now    func() time.Time
+}
+
+type memoryValue struct {
+	value   string
+	expires time.Time
+}
+
+// NewMemoryStore initializes an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		values: make(map[string]memoryValue),
+		now:    time.Now,
+	}
+}
+
+// Get returns the value stored at key, or an empty string if it does not exist.
+func (m *MemoryStore) Get(key string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.get(key), nil
+}
+
+// CompareAndSwap stores value at key only if it still holds old.
+func (m *MemoryStore) CompareAndSwap(key string, old string, value string, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.get(key) != old {
+		return false, nil
+	}
+	m.values[key] = memoryValue{value: value, expires: m.now().Add(ttl)}
+	return true, nil
+}
+
+func (m *MemoryStore) get(key string) string {
+	v, ok := m.values[key]
+	if !ok {
+		return ""
+	}
+	if !m.now().Before(v.expires) {
+		delete(m.values, key)
+		return ""
+	}
+	return v.value
+}
+
+// storeGate books the requests in a Store using the generic cell rate
+// algorithm, whose state is the theoretical arrival time of the next request
+// saved as nanoseconds since the epoch. If the lease size is bigger than one,
+// the slots are booked in batches and dispatched from the local lease.
+type storeGate struct {
+	mu    sync.Mutex
+	store Store
+	key   string
+	limit func() limit
+	size  int64
+	lease storeLease
+}
+
+// storeLease is a batch of consecutive slots booked in the store at once. Every
+// slot may be used from its start until the guard time before its end, which is
+// kept free as safety margin between the dispatches of different processes.
+type storeLease struct {
+	start    time.Time
+	end      time.Time
+	emission time.Duration
+	margin   time.Duration
+	size     int64
+	next     int64
+}
+
+func newStoreGate(store Store, key string, lim func() limit, size int64) *storeGate {
+	return &storeGate{store: store, key: key, limit: lim, size: size}
+}
+
+// book returns the time when the units are granted, taking them from the local
+// lease if there is one with enough slots left
+func (g *storeGate) book(now time.Time, cost int64) (time.Time, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	lim := g.limit()
+	if g.size == 1 || cost > g.size {
+		at, _, err := g.update(now, lim, cost)
+		return at, err
+	}
+	if at, ok := g.lease.take(now, cost); ok {
+		return at, nil
+	}
+	if err := g.giveBack(now); err != nil {
+		return time.Time{}, err
+	}
+	at, end, err := g.update(now, lim, g.size)
+	if err != nil {
+		return time.Time{}, err
+	}
+	g.lease = storeLease{start: at, end: end, emission: lim.emission(), margin: lim.guardTime, size: g.size}
+	at, _ = g.lease.take(now, cost)
+	return at, nil
+}
+
+// close gives the unused slots of the lease back to the store
+func (g *storeGate) close() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.giveBack(time.Now())
+}
+
+// giveBack moves the theoretical arrival time of the store back to the first
+// unused slot of the lease which has not started yet. It is only possible if
+// no other slot was booked after the lease.
+func (g *storeGate) giveBack(now time.Time) error {
+	l := g.lease
+	g.lease = storeLease{}
+	if l.size == 0 {
+		return nil
+	}
+	k := l.next
+	if now.After(l.start) {
+		if c := int64((now.Sub(l.start) + l.emission - 1) / l.emission); c > k {
+			k = c
+		}
+	}
+	if k >= l.size {
+		return nil
+	}
+	back := l.start.Add(time.Duration(k) * l.emission)
+	for i := 0; i < storeRetries; i++ {
+		old, tat, err := g.read()
+		if err != nil {
+			return err
+		}
+		if !tat.Equal(l.end) {
+			return nil
+		}
+		value := strconv.FormatInt(back.UnixNano(), 10)
+		ok, err := g.store.CompareAndSwap(g.key, old, value, back.Sub(now)+time.Second)
+		if err != nil {
+			return fmt.Errorf("unable to update the store: %v", err)
+		}
+		if ok {
+			return nil
+		}
+	}
+	return fmt.Errorf("unable to update the store: too many conflicts")
+}
+
+// update books cost units in the store and returns the time when they are
+// granted and the new theoretical arrival time
+func (g *storeGate) update(now time.Time, lim limit, cost int64) (time.Time, time.Time, error) {
+	for i := 0; i < storeRetries; i++ {
+		old, tat, err := g.read()
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		at := gcraNext(tat, now, lim, 1, cost)
+		tat = gcraCommit(tat, at, lim, cost)
+		value := strconv.FormatInt(tat.UnixNano(), 10)
+		ok, err := g.store.CompareAndSwap(g.key, old, value, tat.Sub(now)+time.Second)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("unable to update the store: %v", err)
+		}
+		if ok {
+			return at, tat, nil
+		}
+	}
+	return time.Time{}, time.Time{}, fmt.Errorf("unable to update the store: too many conflicts")
+}
+
+// read returns the value of the store and the theoretical arrival time it holds
+func (g *storeGate) read() (string, time.Time, error) {
+	old, err := g.store.Get(g.key)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("unable to read the store: %v", err)
+	}
+	if old == "" {
+		return "", time.Time{}, nil
+	}
+	ns, err := strconv.ParseInt(old, 10, 64)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("invalid value in the store: %q", old)
+	}
+	return old, time.Unix(0, ns), nil
+}
+
+// take returns the dispatch time of cost units of the lease, which is now if
+// the current slot is still usable, and reports whether the lease has enough
+// slots left. The slots whose usable part has passed are skipped.
+func (l *storeLease) take(now time.Time, cost int64) (time.Time, bool) {
+	if l.size == 0 {
+		return time.Time{}, false
+	}
+	k := l.next
+	if now.After(l.start) {
+		if c := int64(now.Sub(l.start) / l.emission); c > k {
+			k = c
+		}
+	}
+	at := l.start.Add(time.Duration(k) * l.emission)
+	if at.Before(now) {
+		if now.After(at.Add(l.emission - l.margin)) {
+			k++
+			at = at.Add(l.emission)
+		} else {
+			at = now
+		}
+	}
+	if k+cost > l.size {
+		return time.Time{}, false
+	}
+	l.next = k + cost
+	return at, true
+}
@@ -0,0 +1,200 @@
+package throttler_test
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/centraldereservas/throttler"
+)
+
+func TestWithStore(t *testing.T) {
+	tt := []struct {
+		name   string
+		store  throttler.Store
+		key    string
+		errMsg string
+	}{
+		{"Positive TC", throttler.NewMemoryStore(), "provider", ""},
+		{"Negative TC: store nil", nil, "provider", "store can not be nil"},
+		{"Negative TC: key empty", throttler.NewMemoryStore(), "", "key can not be empty"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			rate, _ := throttler.NewRateByCallsPerSecond(10, 0)
+			_, err := throttler.New(rate, 5, nil, false, throttler.WithStore(tc.store, tc.key))
+			checkError(tc.errMsg, err, t)
+		})
+	}
+}
+
+// testStore checks the compare and swap semantics shared by all the stores
+func testStore(store throttler.Store, t *testing.T) {
+	if v, err := store.Get("key"); err != nil || v != "" {
+		t.Fatalf("expected a missing key; got %q, %v", v, err)
+	}
+	if ok, err := store.CompareAndSwap("key", "other", "1", time.Minute); err != nil || ok {
+		t.Errorf("expected the swap of a missing key with a wrong old value to fail; got %v, %v", ok, err)
+	}
+	if ok, err := store.CompareAndSwap("key", "", "1", time.Minute); err != nil || !ok {
+		t.Fatalf("expected the swap of a missing key to succeed; got %v, %v", ok, err)
+	}
+	if ok, err := store.CompareAndSwap("key", "", "2", time.Minute); err != nil || ok {
+		t.Errorf("expected the swap of an existing key as missing to fail; got %v, %v", ok, err)
+	}
+	if ok, err := store.CompareAndSwap("key", "1", "2", time.Minute); err != nil || !ok {
+		t.Errorf("expected the swap of an existing key to succeed; got %v, %v", ok, err)
+	}
+	if v, err := store.Get("key"); err != nil || v != "2" {
+		t.Errorf("expected value %q; got %q, %v", "2", v, err)
+	}
+	if ok, err := store.CompareAndSwap("expiring", "", "1", 10*time.Millisecond); err != nil || !ok {
+		t.Fatalf("expected the swap of a missing key to succeed; got %v, %v", ok, err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if v, err := store.Get("expiring"); err != nil || v != "" {
+		t.Errorf("expected the key to expire; got %q, %v", v, err)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(throttler.NewMemoryStore(), t)
+}
+
+// testSharedStore queues requests in two throttlers sharing the store and
+// checks that together they do not exceed the rate
+func testSharedStore(store throttler.Store, t *testing.T) {
+	testSharedStores([]throttler.Store{store, store}, t)
+}
+
+// testSharedStores queues requests in a throttler per store, where all the
+// stores share the same state
+func testSharedStores(stores []throttler.Store, t *testing.T) {
+	var opts []throttler.Option
+	for _, store := range stores {
+		opts = append(opts, throttler.WithStore(store, "provider"))
+	}
+	testSharedLimit(opts, t)
+}
+
+// testSharedLimit queues requests in a throttler per option and checks that
+// together they do not exceed the rate shared through the options
+func testSharedLimit(opts []throttler.Option, t *testing.T) {
+	var mu sync.Mutex
+	var sent []time.Time
+	client := &http.Client{
+		Transport: &MockTransport{
+			RoundTripMock: func(req *http.Request) (*http.Response, error) {
+				mu.Lock()
+				sent = append(sent, time.Now())
+				mu.Unlock()
+				return newMockClient(http.StatusOK).Transport.RoundTrip(req)
+			},
+		},
+	}
+
+	var wg sync.WaitGroup
+	for _, opt := range opts {
+		rate, _ := throttler.NewRateByCallsPerSecond(10, 0)
+		limiter, err := throttler.New(rate, 5, client, false, opt)
+		if err != nil {
+			t.Fatalf("unable to create the throttler: %v", err)
+		}
+		limiter.Run()
+		for j := 0; j < 3; j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				req, _ := http.NewRequest("GET", "http://example.com/", nil)
+				res, err := limiter.Queue(context.Background(), "shared request", req, duration10s)
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+					return
+				}
+				res.Body.Close()
+			}()
+		}
+	}
+	wg.Wait()
+
+	// 6 requests at the shared rate of 10 calls per second take at least 500ms
+	sort.Slice(sent, func(i, j int) bool { return sent[i].Before(sent[j]) })
+	if d := sent[len(sent)-1].Sub(sent[0]); d < 450*time.Millisecond {
+		t.Errorf("expected the throttlers to share the rate; all requests sent in %v", d)
+	}
+}
+
+func TestQueueWithStore(t *testing.T) {
+	testSharedStore(throttler.NewMemoryStore(), t)
+}
+
+func TestWithStoreLease(t *testing.T) {
+	tt := []struct {
+		name   string
+		store  throttler.Store
+		size   int
+		errMsg string
+	}{
+		{"Positive TC", throttler.NewMemoryStore(), 5, ""},
+		{"Negative TC: store nil", nil, 5, "store can not be nil"},
+		{"Negative TC: size zero", throttler.NewMemoryStore(), 0, "lease size must be greater than zero"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			rate, _ := throttler.NewRateByCallsPerSecond(10, 0)
+			_, err := throttler.New(rate, 5, nil, false, throttler.WithStoreLease(tc.store, "provider", tc.size))
+			checkError(tc.errMsg, err, t)
+		})
+	}
+}
+
+func TestQueueWithStoreLease(t *testing.T) {
+	store := throttler.NewMemoryStore()
+	testSharedLimit([]throttler.Option{
+		throttler.WithStoreLease(store, "provider", 2),
+		throttler.WithStoreLease(store, "provider", 2),
+	}, t)
+}
+
+// storedTime returns the theoretical arrival time saved in the store
+func storedTime(store throttler.Store, t *testing.T) time.Time {
+	v, err := store.Get("provider")
+	if err != nil {
+		t.Fatalf("unable to read the store: %v", err)
+	}
+	ns, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		t.Fatalf("invalid value in the store: %q", v)
+	}
+	return time.Unix(0, ns)
+}
+
+func TestStoreLeaseClose(t *testing.T) {
+	store := throttler.NewMemoryStore()
+	rate, _ := throttler.NewRateByCallsPerSecond(10, 0)
+	limiter, _ := throttler.New(rate, 5, newMockClient(http.StatusOK), false, throttler.WithStoreLease(store, "provider", 5))
+	limiter.Run()
+	req, _ := http.NewRequest("GET", "http://example.com/", nil)
+	res, err := limiter.Queue(context.Background(), "leased request", req, duration10s)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	res.Body.Close()
+
+	// the lease holds 5 slots of 100ms and the first one was used
+	if d := time.Until(storedTime(store, t)); d < 350*time.Millisecond {
+		t.Errorf("expected the lease to book 5 slots; the store is booked for %v", d)
+	}
+	if err := limiter.Close(); err != nil {
+		t.Fatalf("unable to close: %v", err)
+	}
+	if d := time.Until(storedTime(store, t)); d > 100*time.Millisecond {
+		t.Errorf("expected the unused slots to be given back; the store is booked for %v", d)
+	}
+}
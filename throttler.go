@@ -2,13 +2,20 @@ package throttler
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"sync"
 	"time"
 )
 
+// ErrClosed is returned by Queue and Reserve when the throttler has been closed.
+var ErrClosed = errors.New("throttler is closed")
+
 // Limiter is the interface that contains the basic methods for using the throttler
 // which controls that the queued requests do not overtake the provider rate limits.
+// Version 1.0 added every method after Queue, so the implementations written for
+// 0.1 must add them.
 type Limiter interface {
 	// Rate returns the minimal allowed time.Duration between sending two requests
 	Rate() time.Duration
@@ -18,18 +25,67 @@ type Limiter interface {
 
 	// Queue builds a new throttle.Request and queue it into the requestsChannel to be processed
 	Queue(ctx context.Context, name string, hreq *http.Request, timeout time.Duration) (*http.Response, error)
+
+	// SetRate replaces the rate used by the listener without restarting it
+	SetRate(rate Rate) error
+
+	// Pause stops dispatching requests while Queue keeps accepting them
+	Pause()
+
+	// PauseUntil stops dispatching requests until the given time is reached, resuming them if it is in the past
+	PauseUntil(until time.Time)
+
+	// Resume restarts dispatching requests after a pause
+	Resume()
+
+	// State returns a snapshot of the throttler status
+	State() State
+
+	// Reserve books a slot of n units in the schedule and returns when it will be granted
+	Reserve(ctx context.Context, n int) (*Reservation, error)
+
+	// Close stops the throttler and gives back its resources, like the slots leased from a store
+	Close() error
+
+	// Pending returns a snapshot of the queued requests which have not been sent yet
+	Pending() []PendingRequest
+
+	// CancelByID removes the queued request with the given ID, if it has not been sent yet
+	CancelByID(id uint64) bool
+
+	// CancelByName removes the queued requests with the given name which have not been sent yet
+	CancelByName(name string) int
 }
 
 type throttler struct {
+	mu              sync.Mutex
 	reqChan         chan *Request
 	rate            Rate
 	verbose         bool
 	listener        listener
 	listenerStarted bool
+	gates           []gate
+	strategy        Strategy
+	burst           int
+	cost            func(*http.Request) int
+	parent          *throttler
+	closers         []func() error
+	closed          chan struct{}
+	closeOnce       sync.Once
+	disk            *DiskQueue
+	replayTimeout   time.Duration
+	requestTimeout  time.Duration
+	onReplay        func(name string, res *http.Response, err error)
+	upload          *Bandwidth
+	download        *Bandwidth
+	breaker         *Breaker
+	queued          map[*Request]*queued
+	inFlight        int
+	lastID          uint64
 }
 
-// New initializes the throttler handler.
-func New(rate Rate, reqChanCapacity int, client *http.Client, verbose bool) (Limiter, error) {
+// New initializes the throttler handler. The optional features are enabled with opts.
+func New(rate Rate, reqChanCapacity int, client *http.Client, verbose bool, opts ...Option) (Limiter, error) {
 	if rate == nil {
 		return nil, fmt.Errorf("rate can not be nil")
 	}
@@ -43,17 +99,45 @@ func New(rate Rate, reqChanCapacity int, client *http.Client, verbose bool) (Lim
 	// creates the channel for enqueuing requests
 	requestsCh := make(chan *Request, reqChanCapacity)
 
-	// build services to be injected
-	clientHandler := newClientHandler(client)
-	fulfiller := newFulfiller(clientHandler)
-	listener, _ := newListener(rate.CalculateRate(), requestsCh, verbose, fulfiller)
-
 	throttler := &throttler{
 		reqChan:         requestsCh,
 		rate:            rate,
 		verbose:         verbose,
-		listener:        listener,
 		listenerStarted: false,
+		burst:           1,
+		queued:          make(map[*Request]*queued),
+		closed:          make(chan struct{}),
+	}
+	for _, opt := range opts {
+		if err := opt(throttler); err != nil {
+			return nil, err
+		}
+	}
+
+	// build services to be injected
+	scheduler, err := newScheduler(throttler.strategy, throttler.burst)
+	if err != nil {
+		return nil, err
+	}
+	if throttler.upload != nil || throttler.download != nil {
+		c := *client
+		c.Transport = NewBandwidthTransport(client.Transport, throttler.upload, throttler.download)
+		client = &c
+	}
+	clientHandler := newClientHandler(client)
+	clientHandler = &adaptiveSender{next: clientHandler, t: throttler}
+	gates := throttler.gates
+	if throttler.breaker != nil {
+		// the breaker rejects the requests before other gates count them
+		clientHandler = &breakerSender{next: clientHandler, breaker: throttler.breaker}
+		gates = append([]gate{throttler.breaker}, gates...)
+	}
+	fulfiller := &trackingFulfiller{next: newFulfiller(clientHandler), t: throttler}
+	throttler.listener, _ = newListener(rate, scheduler, requestsCh, verbose, fulfiller, gates...)
+	if throttler.parent != nil {
+		if err := attach(throttler.listener, throttler.parent.listener); err != nil {
+			return nil, err
+		}
 	}
 	return throttler, nil
 }
@@ -63,27 +147,115 @@ func New(rate Rate, reqChanCapacity int, client *http.Client, verbose bool) (Lim
 func (t *throttler) Run() {
 	go t.listener.listen()
 	t.listenerStarted = true
+	if t.disk != nil {
+		go t.replay()
+	}
+}
+
+// replay queues again the requests left pending in the disk queue by the
+// previous process, with as many requests in flight as the requests channel holds
+func (t *throttler) replay() {
+	entries := t.disk.takeReplay()
+	work := make(chan diskEntry)
+	var wg sync.WaitGroup
+	for i := 0; i < cap(t.reqChan)+1; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for e := range work {
+				var res *http.Response
+				hreq, err := e.request()
+				if err == nil {
+					id := e.ID
+					res, err = t.queue(context.Background(), e.Name, hreq, t.replayTimeout, func() { t.disk.done(id) })
+				}
+				if t.onReplay != nil {
+					t.onReplay(e.Name, res, err)
+				} else if res != nil {
+					res.Body.Close()
+				}
+			}
+		}()
+	}
+	for _, e := range entries {
+		work <- e
+	}
+	close(work)
+	wg.Wait()
 }
 
 // Queue is called to queue a new request into the requests channel.
 // It assures that the system will not overtake the rate limit constraint.
+// A timeout of zero is replaced by the one set with WithRequestTimeout.
 func (t *throttler) Queue(ctx context.Context, name string, hreq *http.Request, timeout time.Duration) (*http.Response, error) {
 	if !t.listenerStarted {
 		return nil, fmt.Errorf("requestHandler has not been started")
 	}
+	if t.breaker != nil {
+		if err := t.breaker.check(); err != nil {
+			return nil, err
+		}
+	}
+	if t.disk != nil {
+		id, err := t.disk.add(name, hreq)
+		if err != nil {
+			return nil, err
+		}
+		return t.queue(ctx, name, hreq, timeout, func() { t.disk.done(id) })
+	}
+	return t.queue(ctx, name, hreq, timeout, nil)
+}
 
+// queue sends the request to the listener and waits for its response. The sent
+// function, if any, is called before returning when the request was dispatched.
+func (t *throttler) queue(ctx context.Context, name string, hreq *http.Request, timeout time.Duration, sent func()) (*http.Response, error) {
 	var res *Response
-	c := make(chan *Response)
-	defer close(c)
+	c := make(chan *Response, 1)
 
+	if timeout == 0 {
+		timeout = t.requestTimeout
+	}
 	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
-	request := &Request{ctx, name, hreq, c, timeout}
-	t.reqChan <- request
+	cost := 1
+	if t.cost != nil {
+		cost = t.cost(hreq)
+	}
+	if cost < 0 {
+		return nil, fmt.Errorf("cost can not be negative")
+	}
+
+	request := &Request{
+		ID:      t.newID(),
+		Ctx:     ctx,
+		Name:    name,
+		HReq:    hreq,
+		ResChan: c,
+		Timeout: timeout,
+		Cost:    int64(cost),
+	}
+	forget := t.track(request, cancel)
+	defer func() {
+		if forget() && sent != nil {
+			sent()
+		}
+	}()
+	select {
+	case <-t.closed:
+		return nil, ErrClosed
+	default:
+	}
 	select {
 	case <-ctx.Done():
-		return nil, ctx.Err() // context cancelled
+		return nil, t.ctxErr(request)
+	case <-t.closed:
+		return nil, ErrClosed
+	case t.reqChan <- request:
+	}
+	select {
+	case <-ctx.Done():
+		return nil, t.ctxErr(request) // context cancelled
 	case res = <-c:
 		return res.HRes, res.Err
 	}
@@ -91,5 +263,127 @@ func (t *throttler) Queue(ctx context.Context, name string, hreq *http.Request,
 
 // Rate returns the rate calculated as period + guardTime
 func (t *throttler) Rate() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	return t.rate.CalculateRate()
 }
+
+// Close stops the listener, failing the requests still in the channel with ErrClosed,
+// and gives the unused slots leased from shared stores back, so they can be used by
+// other processes. It should be called on shutdown, once no more requests are queued.
+func (t *throttler) Close() error {
+	t.closeOnce.Do(func() {
+		close(t.closed)
+		t.listener.stop()
+	})
+	var first error
+	for _, c := range t.closers {
+		if err := c(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// limit returns the limit of the current rate
+func (t *throttler) limit() limit {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return limitOf(t.rate)
+}
+
+// SetRate replaces the rate of a running throttler. The request waiting for
+// its turn is rescheduled immediately with the new rate.
+func (t *throttler) SetRate(rate Rate) error {
+	if rate == nil {
+		return fmt.Errorf("rate can not be nil")
+	}
+	t.mu.Lock()
+	t.rate = rate
+	t.mu.Unlock()
+	t.listener.setRate(rate)
+	return nil
+}
+
+// Pause stops dispatching requests until Resume is called. Queue keeps
+// enqueuing requests, which are held until the throttler is resumed.
+func (t *throttler) Pause() {
+	t.listener.pause(time.Time{})
+}
+
+// PauseUntil stops dispatching requests until the given time is reached or
+// Resume is called, whichever happens first. A time already reached ends the
+// current pause like Resume.
+func (t *throttler) PauseUntil(until time.Time) {
+	if !until.After(time.Now()) {
+		t.Resume()
+		return
+	}
+	t.listener.pause(until)
+}
+
+// Resume restarts dispatching the held requests after a pause.
+func (t *throttler) Resume() {
+	t.listener.resume()
+}
+
+// State returns a snapshot of the throttler status.
+func (t *throttler) State() State {
+	paused, until := t.listener.pauseState()
+	return State{
+		Rate:          t.Rate(),
+		Paused:        paused,
+		PausedUntil:   until,
+		QueueLength:   len(t.reqChan),
+		QueueCapacity: cap(t.reqChan),
+		InFlight:      t.inFlightCount(),
+		Breaker:       t.breakerState(),
+	}
+}
+
+func (t *throttler) breakerState() BreakerState {
+	if t.breaker == nil {
+		return BreakerClosed
+	}
+	return t.breaker.State()
+}
+
+func (t *throttler) inFlightCount() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.inFlight
+}
+
+// Reserve books a slot of n units in the schedule shared with the queued requests,
+// so the caller knows in advance when it could send. The reservation also consumes
+// the quotas and the slots of the stores and daemons like a queued request, and it is
+// rejected while the breaker is not closed. The reservation must be either committed
+// or cancelled. If ctx has a deadline before the reservation would be granted, no
+// slot is booked and an error is returned.
+func (t *throttler) Reserve(ctx context.Context, n int) (*Reservation, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("n must be greater than zero")
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	select {
+	case <-t.closed:
+		return nil, ErrClosed
+	default:
+	}
+	at, release, err := t.listener.reserve(int64(n))
+	if err != nil {
+		return nil, err
+	}
+	r := &Reservation{
+		ctx:     ctx,
+		release: release,
+		at:      at,
+	}
+	if deadline, ok := ctx.Deadline(); ok && r.Time().After(deadline) {
+		r.Cancel()
+		return nil, ErrReservationDeadline
+	}
+	return r, nil
+}
@@ -1,9 +1,12 @@
 package throttler_test
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"sync"
 	"testing"
 	"time"
 
@@ -31,6 +34,30 @@ func (m *MockRate) CalculateRate() time.Duration {
 	return m.CalculateRateMock()
 }
 
+type MockTransport struct {
+	RoundTripMock func(req *http.Request) (*http.Response, error)
+}
+
+func (m *MockTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return m.RoundTripMock(req)
+}
+
+// newMockClient returns an http.Client that answers every request with the given status
+func newMockClient(status int) *http.Client {
+	return &http.Client{
+		Transport: &MockTransport{
+			RoundTripMock: func(req *http.Request) (*http.Response, error) {
+				return &http.Response{
+					StatusCode: status,
+					Body:       ioutil.NopCloser(bytes.NewBufferString("")),
+					Header:     make(http.Header),
+					Request:    req,
+				}, nil
+			},
+		},
+	}
+}
+
 func buildThrottler(rate throttler.Rate, maxCallsPerSecond int, guardTime time.Duration, requestChannelCapacity int, verbose bool, client *http.Client) (throttler.Limiter, error) {
 	limiter, err := throttler.New(rate, requestChannelCapacity, client, verbose)
 	if err != nil || limiter == nil {
@@ -147,6 +174,250 @@ func TestRun(t *testing.T) {
 	}
 }
 
+func TestSetRate(t *testing.T) {
+	tt := []struct {
+		name         string
+		rateNil      bool
+		expectedRate time.Duration
+		errMsg       string
+	}{
+		{"Positive TC", false, 2 * time.Second, ""},
+		{"Negative TC: rate nil", true, 0, "rate can not be nil"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			initialRate := &MockRate{
+				CalculateRateMock: func() time.Duration {
+					return 5 * time.Second
+				},
+			}
+			limiter, err := buildThrottler(initialRate, 2, duration50ms, 10, false, nil)
+			if err != nil {
+				t.Fatalf("unable to create a throttler")
+			}
+			limiter.Run()
+
+			var newRate throttler.Rate
+			if !tc.rateNil {
+				newRate = &MockRate{
+					CalculateRateMock: func() time.Duration {
+						return tc.expectedRate
+					},
+				}
+			}
+			err = limiter.SetRate(newRate)
+			if !checkError(tc.errMsg, err, t) {
+				rateDuration := limiter.Rate()
+				if rateDuration != tc.expectedRate {
+					t.Errorf("expected rate duration %v; got %v", tc.expectedRate, rateDuration)
+				}
+			}
+		})
+	}
+}
+
+func TestState(t *testing.T) {
+	tt := []struct {
+		name            string
+		reqChanCapacity int
+		pause           bool
+		pauseUntil      time.Duration
+		expectedPaused  bool
+	}{
+		{"Positive TC: not paused", 5, false, 0, false},
+		{"Positive TC: paused", 5, true, 0, true},
+		{"Positive TC: paused until", 5, false, time.Hour, true},
+		{"Positive TC: pause until in the past does not pause", 5, false, -time.Hour, false},
+		{"Positive TC: pause until in the past resumes", 5, true, -time.Hour, false},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			rate, err := throttler.NewRateByCallsPerSecond(2, duration50ms)
+			if err != nil {
+				t.Fatalf("unable to create a rate")
+			}
+			limiter, err := buildThrottler(rate, 2, duration50ms, tc.reqChanCapacity, false, nil)
+			if err != nil {
+				t.Fatalf("unable to create a throttler")
+			}
+			if tc.pause {
+				limiter.Pause()
+			}
+			if tc.pauseUntil != 0 {
+				limiter.PauseUntil(time.Now().Add(tc.pauseUntil))
+			}
+
+			state := limiter.State()
+			if state.Paused != tc.expectedPaused {
+				t.Errorf("expected paused %v; got %v", tc.expectedPaused, state.Paused)
+			}
+			if state.Rate != duration550ms {
+				t.Errorf("expected rate duration %v; got %v", duration550ms, state.Rate)
+			}
+			if state.QueueCapacity != tc.reqChanCapacity {
+				t.Errorf("expected queue capacity %v; got %v", tc.reqChanCapacity, state.QueueCapacity)
+			}
+
+			limiter.Resume()
+			if limiter.State().Paused {
+				t.Errorf("expected throttler to be resumed")
+			}
+		})
+	}
+}
+
+func TestQueueWithQuota(t *testing.T) {
+	tt := []struct {
+		name     string
+		quotaNil bool
+		limit    int
+		errMsg   string
+	}{
+		{"Positive TC", false, 2, ""},
+		{"Negative TC: quota exhausted", false, 1, "quota exhausted"},
+		{"Negative TC: quota nil", true, 1, "quota can not be nil"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var quota *throttler.Quota
+			if !tc.quotaNil {
+				var err error
+				quota, err = throttler.NewQuota(tc.limit, throttler.Daily, throttler.QuotaReject, nil, "")
+				if err != nil {
+					t.Fatalf("unable to create a quota: %v", err)
+				}
+			}
+			rate, err := throttler.NewRateByCallsPerSecond(100, 0)
+			if err != nil {
+				t.Fatalf("unable to create a rate")
+			}
+			limiter, err := throttler.New(rate, 5, newMockClient(http.StatusOK), false, throttler.WithQuota(quota))
+			if checkError(tc.errMsg, err, t) {
+				return
+			}
+			limiter.Run()
+
+			for i := 0; i < 2; i++ {
+				req, _ := http.NewRequest("GET", "http://example.com/", nil)
+				res, err := limiter.Queue(context.Background(), tc.name, req, duration10s)
+				if i == 0 || !checkError(tc.errMsg, err, t) {
+					if err != nil {
+						t.Fatalf("unexpected error: %v", err)
+					}
+					res.Body.Close()
+				}
+			}
+		})
+	}
+}
+
+func TestQueueWithStrategy(t *testing.T) {
+	tt := []struct {
+		name     string
+		strategy throttler.Strategy
+		burst    int
+		errMsg   string
+	}{
+		{"Positive TC: leaky bucket", throttler.LeakyBucket, 1, ""},
+		{"Positive TC: sliding window log", throttler.SlidingWindowLog, 1, ""},
+		{"Positive TC: sliding window counter", throttler.SlidingWindowCounter, 1, ""},
+		{"Positive TC: gcra with burst", throttler.GCRA, 5, ""},
+		{"Negative TC: unknown strategy", throttler.Strategy(99), 1, "unknown strategy"},
+		{"Negative TC: burst zero", throttler.GCRA, 0, "burst must be greater than zero"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			rate, err := throttler.NewRateByCallsPerSecond(100, 0)
+			if err != nil {
+				t.Fatalf("unable to create a rate")
+			}
+			limiter, err := throttler.New(rate, 5, newMockClient(http.StatusOK), false, throttler.WithStrategy(tc.strategy), throttler.WithBurst(tc.burst))
+			if checkError(tc.errMsg, err, t) {
+				return
+			}
+			limiter.Run()
+
+			req, _ := http.NewRequest("GET", "http://example.com/", nil)
+			res, err := limiter.Queue(context.Background(), tc.name, req, duration10s)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			res.Body.Close()
+		})
+	}
+}
+
+func TestQueueWithCost(t *testing.T) {
+	tt := []struct {
+		name          string
+		costNil       bool
+		firstCost     int
+		expectedDelay time.Duration
+		errMsg        string
+	}{
+		{"Positive TC: bulk request", false, 4, 200 * time.Millisecond, ""},
+		{"Positive TC: free request", false, 0, 0, ""},
+		{"Negative TC: negative cost", false, -1, 0, "cost can not be negative"},
+		{"Negative TC: cost function nil", true, 0, 0, "cost function can not be nil"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var cost func(*http.Request) int
+			if !tc.costNil {
+				cost = func(req *http.Request) int {
+					if req.URL.Path == "/first" {
+						return tc.firstCost
+					}
+					return 1
+				}
+			}
+			var mu sync.Mutex
+			sent := make(map[string]time.Time)
+			client := &http.Client{
+				Transport: &MockTransport{
+					RoundTripMock: func(req *http.Request) (*http.Response, error) {
+						mu.Lock()
+						sent[req.URL.Path] = time.Now()
+						mu.Unlock()
+						return newMockClient(http.StatusOK).Transport.RoundTrip(req)
+					},
+				},
+			}
+			rate, err := throttler.NewRateByCallsPerSecond(20, 0)
+			if err != nil {
+				t.Fatalf("unable to create a rate")
+			}
+			limiter, err := throttler.New(rate, 5, client, false, throttler.WithCost(cost))
+			if checkError(tc.errMsg, err, t) {
+				return
+			}
+			limiter.Run()
+
+			for _, path := range []string{"/first", "/second"} {
+				req, _ := http.NewRequest("GET", "http://example.com"+path, nil)
+				res, err := limiter.Queue(context.Background(), path, req, duration10s)
+				if checkError(tc.errMsg, err, t) {
+					return
+				}
+				res.Body.Close()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			delay := sent["/second"].Sub(sent["/first"])
+			// the requests are sent in new goroutines, which adds some jitter
+			if delay < tc.expectedDelay-20*time.Millisecond || delay > tc.expectedDelay+100*time.Millisecond {
+				t.Errorf("expected a delay of %v between the requests; got %v", tc.expectedDelay, delay)
+			}
+		})
+	}
+}
+
 func TestQueue(t *testing.T) {
 	tt := []struct {
 		name                string
@@ -227,6 +498,38 @@ func TestRun(t *testing.T) {
 
 */
 
+func TestClose(t *testing.T) {
+	rate, _ := throttler.NewRateByCallsPerSecond(100, 0)
+	limiter, _ := throttler.New(rate, 5, newMockClient(http.StatusOK), false)
+	limiter.Run()
+	if _, err := queueStatus(limiter); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the request held by the paused listener and the one left in the channel fail
+	limiter.Pause()
+	errs := queuePaused(limiter, "held", "left")
+	if err := limiter.Close(); err != nil {
+		t.Fatalf("unable to close: %v", err)
+	}
+	for i, c := range errs {
+		select {
+		case err := <-c:
+			if err != throttler.ErrClosed {
+				t.Errorf("expected error %v for request %d; got %v", throttler.ErrClosed, i, err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("request %d not failed by Close", i)
+		}
+	}
+	if _, err := queueStatus(limiter); err != throttler.ErrClosed {
+		t.Errorf("expected error %v; got %v", throttler.ErrClosed, err)
+	}
+	if _, err := limiter.Reserve(context.Background(), 1); err != throttler.ErrClosed {
+		t.Errorf("expected error %v from Reserve; got %v", throttler.ErrClosed, err)
+	}
+}
+
 func checkError(errMsg string, err error, t *testing.T) bool {
 	if err != nil {
 		if errMsg == "" {
@@ -0,0 +1,183 @@
+package throttler
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+// ErrPurged is returned by Queue for the requests removed from the queue by a purge.
+var ErrPurged = errors.New("request purged")
+
+// ErrCancelled is returned by Queue for the requests removed from the queue by
+// CancelByID or CancelByName.
+var ErrCancelled = errors.New("request cancelled")
+
+// PendingRequest describes a queued request which has not been sent yet.
+type PendingRequest struct {
+	// ID identifies the request in CancelByID
+	ID uint64
+
+	// Name is the name given to Queue
+	Name string
+
+	// QueuedAt is the time when Queue was called
+	QueuedAt time.Time
+
+	// Deadline is the time when Queue gives up waiting for the response
+	Deadline time.Time
+
+	// Position is the number of requests to be sent before this one, zero for the next one
+	Position int
+}
+
+// queued is a request tracked by the throttler from the moment it is queued
+// until Queue returns
+type queued struct {
+	req       *Request
+	queuedAt  time.Time
+	inFlight  bool
+	sent      bool
+	cancel    func()
+	cancelled bool
+}
+
+// trackingFulfiller marks the requests as in flight while they are fulfilled
+type trackingFulfiller struct {
+	next fulfiller
+	t    *throttler
+}
+
+func (f *trackingFulfiller) fulfill(req *Request) {
+	f.t.setInFlight(req, true)
+	defer f.t.setInFlight(req, false)
+	f.next.fulfill(req)
+}
+
+// newID returns the ID of a new request
+func (t *throttler) newID() uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.lastID++
+	return t.lastID
+}
+
+// track registers a queued request, whose context is cancelled with cancel,
+// and returns the function that forgets it and reports whether it was sent
+func (t *throttler) track(req *Request, cancel func()) func() bool {
+	t.mu.Lock()
+	t.queued[req] = &queued{req: req, queuedAt: time.Now(), cancel: cancel}
+	t.mu.Unlock()
+	return func() bool {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		sent := t.queued[req].sent
+		delete(t.queued, req)
+		return sent
+	}
+}
+
+// setInFlight updates the number of requests being fulfilled and the state of the request
+func (t *throttler) setInFlight(req *Request, inFlight bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if inFlight {
+		t.inFlight++
+	} else {
+		t.inFlight--
+	}
+	if q, ok := t.queued[req]; ok {
+		q.inFlight = inFlight
+		q.sent = q.sent || inFlight
+	}
+}
+
+// tracked returns a copy of the tracked requests in the order they were queued
+func (t *throttler) tracked() []queued {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	list := make([]queued, 0, len(t.queued))
+	for _, q := range t.queued {
+		list = append(list, *q)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].req.ID < list[j].req.ID })
+	return list
+}
+
+// Pending returns a snapshot of the queued requests which have not been sent
+// yet, in the order they will be sent.
+func (t *throttler) Pending() []PendingRequest {
+	var pending []PendingRequest
+	for _, q := range t.tracked() {
+		if q.inFlight || q.cancelled || q.req.Ctx.Err() != nil {
+			continue
+		}
+		deadline, _ := q.req.Ctx.Deadline()
+		pending = append(pending, PendingRequest{
+			ID:       q.req.ID,
+			Name:     q.req.Name,
+			QueuedAt: q.queuedAt,
+			Deadline: deadline,
+			Position: len(pending),
+		})
+	}
+	return pending
+}
+
+// CancelByID removes the queued request with the given ID, which makes Queue
+// return ErrCancelled. It reports whether the request was found before being sent.
+func (t *throttler) CancelByID(id uint64) bool {
+	return t.cancelWhere(func(req *Request) bool { return req.ID == id }) > 0
+}
+
+// CancelByName removes the queued requests with the given name, which makes Queue
+// return ErrCancelled. It returns the number of requests found before being sent.
+func (t *throttler) CancelByName(name string) int {
+	return t.cancelWhere(func(req *Request) bool { return req.Name == name })
+}
+
+// cancelWhere cancels the requests not sent yet which match
+func (t *throttler) cancelWhere(match func(*Request) bool) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n := 0
+	for req, q := range t.queued {
+		if q.inFlight || q.cancelled || !match(req) {
+			continue
+		}
+		q.cancelled = true
+		q.cancel()
+		n++
+	}
+	return n
+}
+
+// ctxErr returns the error of a request whose context is done
+func (t *throttler) ctxErr(req *Request) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if q, ok := t.queued[req]; ok && q.cancelled {
+		return ErrCancelled
+	}
+	return req.Ctx.Err()
+}
+
+// purge removes the requests waiting in the requests channel, which fail with
+// ErrPurged, and returns how many were removed. The request the listener is
+// waiting to dispatch is not in the channel and is not removed. The requests
+// already abandoned by Queue are dropped without being counted.
+func (t *throttler) purge() int {
+	n := 0
+	for {
+		select {
+		case req := <-t.reqChan:
+			if req.Ctx.Err() != nil {
+				continue
+			}
+			go reject(req, ErrPurged)
+			n++
+		default:
+			return n
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package throttler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type yamlLine struct {
+	number int
+	indent int
+	text   string
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+// decodeYAML converts the subset of YAML used by the configuration files into
+// values that encoding/json can marshal. It supports block mappings, block
+// sequences, flow sequences, scalars and comments, and returns an error for the
+// rest, like anchors, tags, flow mappings, multi-line strings, tabs or multiple
+// documents, instead of misreading them.
+func decodeYAML(data []byte) (interface{}, error) {
+	p := &yamlParser{}
+	for i, raw := range strings.Split(string(data), "\n") {
+		raw = strings.TrimRight(raw, " \r")
+		if strings.Contains(raw, "\t") {
+			return nil, fmt.Errorf("yaml line %d: tabs are not supported", i+1)
+		}
+		text := stripYAMLComment(strings.TrimLeft(raw, " "))
+		if text == "---" && len(p.lines) == 0 {
+			continue
+		}
+		if text == "---" || text == "..." {
+			return nil, fmt.Errorf("yaml line %d: multiple documents are not supported", i+1)
+		}
+		if strings.HasPrefix(text, "%") || strings.HasPrefix(text, "? ") {
+			return nil, fmt.Errorf("yaml line %d: unsupported construct %q", i+1, text)
+		}
+		if text == "" {
+			continue
+		}
+		p.lines = append(p.lines, yamlLine{number: i + 1, indent: len(raw) - len(strings.TrimLeft(raw, " ")), text: text})
+	}
+	if len(p.lines) == 0 {
+		return nil, nil
+	}
+	v, err := p.parseBlock(p.lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.lines) {
+		return nil, fmt.Errorf("yaml line %d: unexpected indentation", p.lines[p.pos].number)
+	}
+	return v, nil
+}
+
+func (p *yamlParser) parseBlock(indent int) (interface{}, error) {
+	if isYAMLSequenceItem(p.lines[p.pos].text) {
+		return p.parseSequence(indent)
+	}
+	return p.parseMapping(indent)
+}
+
+func (p *yamlParser) parseMapping(indent int) (interface{}, error) {
+	m := make(map[string]interface{})
+	for p.pos < len(p.lines) && p.lines[p.pos].indent == indent && !isYAMLSequenceItem(p.lines[p.pos].text) {
+		line := p.lines[p.pos]
+		key, value, ok := splitYAMLKey(line.text)
+		if !ok {
+			return nil, fmt.Errorf("yaml line %d: expected key: value", line.number)
+		}
+		if key == "" || strings.ContainsAny(key[:1], "&*!{}[]|>@`%?-") {
+			return nil, fmt.Errorf("yaml line %d: unsupported key %q", line.number, key)
+		}
+		if _, ok := m[key]; ok {
+			return nil, fmt.Errorf("yaml line %d: duplicate key %q", line.number, key)
+		}
+		p.pos++
+		if value != "" {
+			v, err := parseYAMLScalar(value)
+			if err != nil {
+				return nil, fmt.Errorf("yaml line %d: %v", line.number, err)
+			}
+			m[key] = v
+			continue
+		}
+		if p.pos < len(p.lines) {
+			next := p.lines[p.pos]
+			if next.indent > indent || (next.indent == indent && isYAMLSequenceItem(next.text)) {
+				v, err := p.parseBlock(next.indent)
+				if err != nil {
+					return nil, err
+				}
+				m[key] = v
+				continue
+			}
+		}
+		m[key] = nil
+	}
+	return m, nil
+}
+
+func (p *yamlParser) parseSequence(indent int) (interface{}, error) {
+	s := []interface{}{}
+	for p.pos < len(p.lines) && p.lines[p.pos].indent == indent && isYAMLSequenceItem(p.lines[p.pos].text) {
+		line := p.lines[p.pos]
+		rest := strings.TrimLeft(strings.TrimPrefix(line.text, "-"), " ")
+		if rest == "" {
+			p.pos++
+			if p.pos >= len(p.lines) || p.lines[p.pos].indent <= indent {
+				s = append(s, nil)
+				continue
+			}
+			v, err := p.parseBlock(p.lines[p.pos].indent)
+			if err != nil {
+				return nil, err
+			}
+			s = append(s, v)
+			continue
+		}
+		if _, _, ok := splitYAMLKey(rest); ok && !strings.HasPrefix(rest, "[") {
+			// a mapping starting on the same line as the dash continues with
+			// the indentation of its first key
+			p.lines[p.pos] = yamlLine{number: line.number, indent: indent + len(line.text) - len(rest), text: rest}
+			v, err := p.parseMapping(p.lines[p.pos].indent)
+			if err != nil {
+				return nil, err
+			}
+			s = append(s, v)
+			continue
+		}
+		p.pos++
+		v, err := parseYAMLScalar(rest)
+		if err != nil {
+			return nil, fmt.Errorf("yaml line %d: %v", line.number, err)
+		}
+		s = append(s, v)
+	}
+	return s, nil
+}
+
+func isYAMLSequenceItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+func splitYAMLKey(text string) (string, string, bool) {
+	if strings.HasPrefix(text, `"`) || strings.HasPrefix(text, `'`) {
+		return "", "", false
+	}
+	if strings.HasSuffix(text, ":") {
+		return strings.TrimSpace(text[:len(text)-1]), "", true
+	}
+	i := strings.Index(text, ": ")
+	if i < 0 {
+		return "", "", false
+	}
+	return strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+2:]), true
+}
+
+func stripYAMLComment(text string) string {
+	if strings.HasPrefix(text, "#") {
+		return ""
+	}
+	quote := byte(0)
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && text[i-1] == ' ':
+			return strings.TrimRight(text[:i], " ")
+		}
+	}
+	return text
+}
+
+// splitYAMLFlow splits the items of a flow sequence on the commas which are
+// not quoted
+func splitYAMLFlow(inner string) []string {
+	var items []string
+	quote := byte(0)
+	start := 0
+	for i := 0; i < len(inner); i++ {
+		switch c := inner[i]; {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ',':
+			items = append(items, inner[start:i])
+			start = i + 1
+		}
+	}
+	return append(items, inner[start:])
+}
+
+// parseYAMLScalar converts a plain, quoted or flow sequence value, and returns an
+// error for the values which start a construct that is not supported
+func parseYAMLScalar(value string) (interface{}, error) {
+	switch {
+	case strings.HasPrefix(value, `"`):
+		s, err := strconv.Unquote(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid double quoted string %v", value)
+		}
+		return s, nil
+	case strings.HasPrefix(value, "'"):
+		if len(value) < 2 || !strings.HasSuffix(value, "'") || strings.Contains(strings.Replace(value[1:len(value)-1], "''", "", -1), "'") {
+			return nil, fmt.Errorf("invalid single quoted string %v", value)
+		}
+		return strings.Replace(value[1:len(value)-1], "''", "'", -1), nil
+	case strings.HasPrefix(value, "["):
+		if !strings.HasSuffix(value, "]") {
+			return nil, fmt.Errorf("flow sequences must be closed on the same line")
+		}
+		s := []interface{}{}
+		inner := strings.TrimSpace(value[1 : len(value)-1])
+		if inner == "" {
+			return s, nil
+		}
+		for _, item := range splitYAMLFlow(inner) {
+			item = strings.TrimSpace(item)
+			if item == "" || strings.HasPrefix(item, "[") {
+				return nil, fmt.Errorf("unsupported flow sequence %v", value)
+			}
+			v, err := parseYAMLScalar(item)
+			if err != nil {
+				return nil, err
+			}
+			s = append(s, v)
+		}
+		return s, nil
+	case value == "null" || value == "~":
+		return nil, nil
+	case value == "true":
+		return true, nil
+	case value == "false":
+		return false, nil
+	case strings.ContainsAny(value[:1], "&*!{}|>@`]%?"):
+		return nil, fmt.Errorf("unsupported value %v: anchors, aliases, tags, flow mappings and multi-line strings are not supported", value)
+	case strings.Contains(value, ": "):
+		return nil, fmt.Errorf("unsupported value %v: mappings must start on a new line", value)
+	}
+	if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return i, nil
+	}
+	if f, err := strconv.ParseFloat(value, 64); err == nil {
+		return f, nil
+	}
+	return value, nil
+}
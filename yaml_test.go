@@ -0,0 +1,71 @@
+package throttler
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseYAMLScalarFlowSequence(t *testing.T) {
+	tt := []struct {
+		name     string
+		value    string
+		expected []interface{}
+	}{
+		{"Positive TC: plain items", "[sat, sun]", []interface{}{"sat", "sun"}},
+		{"Positive TC: empty", "[]", []interface{}{}},
+		{"Positive TC: double quoted comma", `["a,b", c]`, []interface{}{"a,b", "c"}},
+		{"Positive TC: single quoted comma", `['a, b', 'it''s']`, []interface{}{"a, b", "it's"}},
+		{"Positive TC: escaped quote", `["a\",b", 1]`, []interface{}{`a",b`, int64(1)}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			if v, err := parseYAMLScalar(tc.value); err != nil || !reflect.DeepEqual(v, tc.expected) {
+				t.Errorf("expected %#v; got %#v, %v", tc.expected, v, err)
+			}
+		})
+	}
+}
+
+func TestDecodeYAML(t *testing.T) {
+	tt := []struct {
+		name     string
+		data     string
+		expected interface{}
+		errMsg   string
+	}{
+		{"Positive TC: mapping", "rate: 2/s\nburst: 4\n", map[string]interface{}{"rate": "2/s", "burst": int64(4)}, ""},
+		{"Positive TC: sequence of mappings", "---\nschedule:\n  - days: [sat]\n    rate: 4/s\n", map[string]interface{}{"schedule": []interface{}{map[string]interface{}{"days": []interface{}{"sat"}, "rate": "4/s"}}}, ""},
+		{"Negative TC: tab indentation", "quota:\n\tlimit: 10\n", nil, "yaml line 2: tabs are not supported"},
+		{"Negative TC: tab after the key", "rate:\t2/s\n", nil, "yaml line 1: tabs are not supported"},
+		{"Negative TC: anchor", "base: &base 2/s\n", nil, "yaml line 1: unsupported value &base 2/s: anchors, aliases, tags, flow mappings and multi-line strings are not supported"},
+		{"Negative TC: alias", "rate: *base\n", nil, "yaml line 1: unsupported value *base: anchors, aliases, tags, flow mappings and multi-line strings are not supported"},
+		{"Negative TC: merge key", "quota:\n  <<: *base\n", nil, "yaml line 2: unsupported value *base: anchors, aliases, tags, flow mappings and multi-line strings are not supported"},
+		{"Negative TC: anchored key", "&a rate: 2/s\n", nil, `yaml line 1: unsupported key "&a rate"`},
+		{"Negative TC: tag", "limit: !!str 10\n", nil, "yaml line 1: unsupported value !!str 10: anchors, aliases, tags, flow mappings and multi-line strings are not supported"},
+		{"Negative TC: flow mapping", "quota: {limit: 10}\n", nil, "yaml line 1: unsupported value {limit: 10}: anchors, aliases, tags, flow mappings and multi-line strings are not supported"},
+		{"Negative TC: flow mapping item", "schedule:\n  - {rate: 4/s}\n", nil, `yaml line 2: unsupported key "{rate"`},
+		{"Negative TC: flow mapping in a flow sequence", "days: [{a: 1}]\n", nil, "yaml line 1: unsupported value {a: 1}: anchors, aliases, tags, flow mappings and multi-line strings are not supported"},
+		{"Negative TC: nested flow sequence", "days: [[sat], sun]\n", nil, "yaml line 1: unsupported flow sequence [[sat], sun]"},
+		{"Negative TC: multi-line flow sequence", "days: [sat,\n  sun]\n", nil, "yaml line 1: flow sequences must be closed on the same line"},
+		{"Negative TC: literal block scalar", "rate: |\n  2/s\n", nil, "yaml line 1: unsupported value |: anchors, aliases, tags, flow mappings and multi-line strings are not supported"},
+		{"Negative TC: folded block scalar", "rate: >-\n  2/s\n", nil, "yaml line 1: unsupported value >-: anchors, aliases, tags, flow mappings and multi-line strings are not supported"},
+		{"Negative TC: multi-line plain scalar", "rate: 120/min\n  +50ms\nburst: 4\n", nil, "yaml line 2: unexpected indentation"},
+		{"Negative TC: multi-line quoted scalar", "rate: \"120/min\n  +50ms\"\n", nil, `yaml line 1: invalid double quoted string "120/min`},
+		{"Negative TC: unclosed single quote", "rate: '2/s\n", nil, "yaml line 1: invalid single quoted string '2/s"},
+		{"Negative TC: compact mapping", "quota: limit: 10\n", nil, "yaml line 1: unsupported value limit: 10: mappings must start on a new line"},
+		{"Negative TC: duplicate key", "rate: 2/s\nrate: 4/s\n", nil, `yaml line 2: duplicate key "rate"`},
+		{"Negative TC: multiple documents", "rate: 2/s\n---\nrate: 4/s\n", nil, "yaml line 2: multiple documents are not supported"},
+		{"Negative TC: directive", "%YAML 1.2\nrate: 2/s\n", nil, `yaml line 1: unsupported construct "%YAML 1.2"`},
+		{"Negative TC: complex key", "? rate\n: 2/s\n", nil, `yaml line 1: unsupported construct "? rate"`},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			v, err := decodeYAML([]byte(tc.data))
+			if !checkError(tc.errMsg, err, t) && !reflect.DeepEqual(v, tc.expected) {
+				t.Errorf("expected %#v; got %#v", tc.expected, v)
+			}
+		})
+	}
+}